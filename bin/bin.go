@@ -3,13 +3,13 @@ package bin
 import (
 	"encoding/json"
 	"os"
+	"os/signal"
 	"runtime/pprof"
 	"sync"
+	"syscall"
 	"time"
 
-	"fmt"
 	"runtime"
-	"strings"
 
 	log "github.com/sirupsen/logrus"
 	flags "github.com/zmap/zflags"
@@ -18,34 +18,24 @@ import (
 
 // Get the value of the ZGRAB2_MEMPROFILE variable (or the empty string).
 // This may include {TIMESTAMP} or {NANOS}, which should be replaced using
-// getFormattedFile().
+// zgrab2.FormatFileName().
 func getMemProfileFile() string {
 	return os.Getenv("ZGRAB2_MEMPROFILE")
 }
 
 // Get the value of the ZGRAB2_CPUPROFILE variable (or the empty string).
 // This may include {TIMESTAMP} or {NANOS}, which should be replaced using
-// getFormattedFile().
+// zgrab2.FormatFileName().
 func getCPUProfileFile() string {
 	return os.Getenv("ZGRAB2_CPUPROFILE")
 }
 
-// Replace instances in formatString of {TIMESTAMP} with when formatted as
-// YYYYMMDDhhmmss, and {NANOS} as the decimal nanosecond offset.
-func getFormattedFile(formatString string, when time.Time) string {
-	timestamp := when.Format("20060102150405")
-	nanos := fmt.Sprintf("%d", when.Nanosecond())
-	ret := strings.Replace(formatString, "{TIMESTAMP}", timestamp, -1)
-	ret = strings.Replace(ret, "{NANOS}", nanos, -1)
-	return ret
-}
-
 // If memory profiling is enabled (ZGRAB2_MEMPROFILE is not empty), perform a GC
 // then write the heap profile to the profile file.
 func dumpHeapProfile() {
 	if file := getMemProfileFile(); file != "" {
 		now := time.Now()
-		fullFile := getFormattedFile(file, now)
+		fullFile := zgrab2.FormatFileName(file, now)
 		f, err := os.Create(fullFile)
 		if err != nil {
 			log.Fatal("could not create heap profile: ", err)
@@ -64,7 +54,7 @@ func dumpHeapProfile() {
 func startCPUProfile() {
 	if file := getCPUProfileFile(); file != "" {
 		now := time.Now()
-		fullFile := getFormattedFile(file, now)
+		fullFile := zgrab2.FormatFileName(file, now)
 		f, err := os.Create(fullFile)
 		if err != nil {
 			log.Fatal("could not create CPU profile: ", err)
@@ -83,6 +73,20 @@ func stopCPUProfile() {
 	}
 }
 
+// handleSignals interrupts the scan on the first SIGINT or SIGTERM, letting
+// it shut down cleanly, and exits immediately on the second.
+func handleSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Warnf("received %s, shutting down (send again to exit immediately)", sig)
+		zgrab2.Interrupt()
+		sig = <-signals
+		log.Fatalf("received %s again, exiting without writing the summary", sig)
+	}()
+}
+
 // ZGrab2Main should be called by func main() in a binary. The caller is
 // responsible for importing any modules in use. This allows clients to easily
 // include custom sets of scan modules by creating new main packages with custom
@@ -125,31 +129,42 @@ func ZGrab2Main() {
 			mod := zgrab2.GetModule(modTypes[i])
 			s := mod.NewScanner()
 			s.Init(f)
-			zgrab2.RegisterScan(s.GetName(), s)
+			zgrab2.RegisterScanWithFlags(s.GetName(), s, f)
 		}
 	} else {
 		mod := zgrab2.GetModule(moduleType)
 		s := mod.NewScanner()
 		s.Init(flag)
-		zgrab2.RegisterScan(moduleType, s)
+		zgrab2.RegisterScanWithFlags(moduleType, s, flag)
 	}
 	wg := sync.WaitGroup{}
 	monitor := zgrab2.MakeMonitor(1, &wg)
 	monitor.Callback = func(_ string) {
 		dumpHeapProfile()
 	}
+	handleSignals()
 	start := time.Now()
 	log.Infof("started grab at %s", start.Format(time.RFC3339))
 	zgrab2.Process(monitor)
 	end := time.Now()
 	log.Infof("finished grab at %s", end.Format(time.RFC3339))
-	monitor.Stop()
-	wg.Wait()
+	// Abandoned grabs may still report to the monitor, so it can only be
+	// stopped if every grab finished.
+	if !zgrab2.Abandoned() {
+		monitor.Stop()
+		wg.Wait()
+	}
 	s := Summary{
 		StatusesPerModule: monitor.GetStatuses(),
+		Metrics:           monitor.GetMetrics(),
 		StartTime:         start.Format(time.RFC3339),
 		EndTime:           end.Format(time.RFC3339),
 		Duration:          end.Sub(start).String(),
+		Discovery:         zgrab2.GetDiscoveryStats(),
+		Interrupted:       zgrab2.Interrupted(),
+		Seed:              zgrab2.GetRandomizeSeed(),
+		Shard:             zgrab2.GetShard(),
+		Excluded:          zgrab2.GetExcludedTargets(),
 	}
 	enc := json.NewEncoder(zgrab2.GetMetaFile())
 	if err := enc.Encode(&s); err != nil {
@@ -4,8 +4,14 @@ import "github.com/zmap/zgrab2"
 
 // Summary holds the results of a run of a ZGrab2 binary.
 type Summary struct {
-	StatusesPerModule map[string]*zgrab2.State `json:"statuses"`
-	StartTime         string                   `json:"start"`
-	EndTime           string                   `json:"end"`
-	Duration          string                   `json:"duration"`
+	StatusesPerModule map[string]*zgrab2.State                             `json:"statuses"`
+	Metrics           map[string]map[zgrab2.ScanStatus]*zgrab2.ScanMetrics `json:"metrics,omitempty"`
+	StartTime         string                                               `json:"start"`
+	EndTime           string                                               `json:"end"`
+	Duration          string                                               `json:"duration"`
+	Discovery         *zgrab2.DiscoveryStats                               `json:"discovery,omitempty"`
+	Interrupted       bool                                                 `json:"interrupted,omitempty"`
+	Seed              *int64                                               `json:"seed,omitempty"`
+	Shard             *zgrab2.Shard                                        `json:"shard,omitempty"`
+	Excluded          *uint64                                              `json:"excluded,omitempty"`
 }
@@ -0,0 +1,213 @@
+package zgrab2
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// prefixTree is a binary radix tree of network prefixes, used to check
+// addresses against the --allowlist-file and --blocklist-file. IPv4
+// prefixes are stored as IPv4-mapped IPv6 prefixes.
+type prefixTree struct {
+	root prefixNode
+}
+
+type prefixNode struct {
+	children [2]*prefixNode
+	// covered is set if the prefix ending at this node is in the tree, in
+	// which case every address below it is.
+	covered bool
+}
+
+// insert adds a network to the tree.
+func (t *prefixTree) insert(ipnet *net.IPNet) {
+	ones, size := ipnet.Mask.Size()
+	if size == net.IPv4len*8 {
+		ones += 96
+	}
+	ip := ipnet.IP.To16()
+	node := &t.root
+	for i := 0; i < ones && !node.covered; i++ {
+		bit := ip[i/8] >> uint(7-i%8) & 1
+		if node.children[bit] == nil {
+			node.children[bit] = new(prefixNode)
+		}
+		node = node.children[bit]
+	}
+	node.covered = true
+	node.children = [2]*prefixNode{}
+}
+
+// contains reports whether the address is in one of the networks in the
+// tree.
+func (t *prefixTree) contains(ip net.IP) bool {
+	ip = ip.To16()
+	if ip == nil {
+		return false
+	}
+	node := &t.root
+	for i := 0; node != nil; i++ {
+		if node.covered {
+			return true
+		}
+		if i == net.IPv6len*8 {
+			return false
+		}
+		node = node.children[ip[i/8]>>uint(7-i%8)&1]
+	}
+	return false
+}
+
+// readPrefixTree reads a list of networks in the format of ZMap's blocklist
+// and allowlist files: one address or CIDR block per line, with comments
+// starting with # and blank lines ignored.
+func readPrefixTree(source io.Reader) (*prefixTree, error) {
+	ret := new(prefixTree)
+	scanner := bufio.NewScanner(source)
+	for line := 1; scanner.Scan(); line++ {
+		entry := scanner.Text()
+		if i := strings.IndexByte(entry, '#'); i >= 0 {
+			entry = entry[:i]
+		}
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ipnet, err := parseNetwork(entry)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		ret.insert(ipnet)
+	}
+	return ret, scanner.Err()
+}
+
+// parseNetwork parses an address or a CIDR block.
+func parseNetwork(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipnet, err := net.ParseCIDR(s)
+		return ipnet, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid address %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// loadPrefixTree reads a list of networks from a file.
+func loadPrefixTree(path string) (*prefixTree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ret, err := readPrefixTree(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return ret, nil
+}
+
+// addressFilter enforces the --allowlist-file and --blocklist-file on the
+// targets generated from the input. A nil *addressFilter allows everything.
+type addressFilter struct {
+	allow    *prefixTree
+	block    *prefixTree
+	excluded uint64
+}
+
+// targetFilter is nil unless an allowlist or blocklist was given.
+var targetFilter *addressFilter
+
+// allows reports whether the address may be scanned: it must be in the
+// allowlist, if there is one, and not in the blocklist. Targets without an
+// address are allowed here, and checked by filterDialer once their domain is
+// resolved.
+func (f *addressFilter) allows(ip net.IP) bool {
+	if f == nil || ip == nil {
+		return true
+	}
+	return (f.allow == nil || f.allow.contains(ip)) && (f.block == nil || !f.block.contains(ip))
+}
+
+// allowsTarget is allows for a target read from the input (or found by
+// --resolve), counting the target if it is excluded. The checks made when
+// dialing are not counted, so that retries and redirects do not add to the
+// count.
+func (f *addressFilter) allowsTarget(ip net.IP) bool {
+	if f.allows(ip) {
+		return true
+	}
+	atomic.AddUint64(&f.excluded, 1)
+	return false
+}
+
+// ErrAddressExcluded is returned when dialing an address excluded by the
+// allowlist or blocklist, such as the address of a domain target or of an
+// HTTP redirect, or a domain through a proxy.
+var ErrAddressExcluded = errors.New("address excluded by the allowlist or blocklist")
+
+// filterDialer returns a copy of d that refuses to connect to the addresses
+// excluded by the allowlist or blocklist, or d itself if neither was given.
+// The check is made on the address a domain resolved to, before the
+// connection is attempted.
+func filterDialer(d *net.Dialer) *net.Dialer {
+	if targetFilter == nil {
+		return d
+	}
+	ret := *d
+	control := d.Control
+	ret.Control = func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if !targetFilter.allows(net.ParseIP(host)) {
+			return ErrAddressExcluded
+		}
+		if control != nil {
+			return control(network, address, c)
+		}
+		return nil
+	}
+	return &ret
+}
+
+// checkProxiedAddress returns ErrAddressExcluded if address, which is to be
+// reached through a proxy, is excluded by the allowlist or blocklist. Since
+// the proxy resolves domains out of sight, a domain is refused whenever
+// there is a list.
+func checkProxiedAddress(address string) error {
+	if targetFilter == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !targetFilter.allows(ip) {
+		return ErrAddressExcluded
+	}
+	return nil
+}
+
+// GetExcludedTargets returns the number of targets skipped because of the
+// allowlist or blocklist, or nil if neither was given.
+func GetExcludedTargets() *uint64 {
+	if targetFilter == nil {
+		return nil
+	}
+	excluded := atomic.LoadUint64(&targetFilter.excluded)
+	return &excluded
+}
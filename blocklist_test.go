@@ -0,0 +1,142 @@
+package zgrab2
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrefixTree(t *testing.T) {
+	tree, err := readPrefixTree(strings.NewReader(`
+# opt-outs
+10.0.0.0/8
+192.168.1.1      # a single host
+192.168.1.0/24   # covers the host above
+
+2001:db8::/32
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"10.0.0.0", true},
+		{"10.255.255.255", true},
+		{"11.0.0.0", false},
+		{"9.255.255.255", false},
+		{"192.168.1.77", true},
+		{"192.168.2.1", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+		{"::ffff:10.1.2.3", true},
+	}
+	for _, test := range tests {
+		if got := tree.contains(net.ParseIP(test.ip)); got != test.expected {
+			t.Errorf("contains(%s) = %v, expected %v", test.ip, got, test.expected)
+		}
+	}
+
+	for _, bad := range []string{"10.0.0.0/33", "example.com", "10.0.0.0/8 10.0.0.1"} {
+		if _, err := readPrefixTree(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestTargetFilter(t *testing.T) {
+	defer func(filter *addressFilter) {
+		targetFilter = filter
+	}(targetFilter)
+	allow, _ := readPrefixTree(strings.NewReader("10.0.0.0/29\n"))
+	block, _ := readPrefixTree(strings.NewReader("10.0.0.2\n10.0.0.6/31\n"))
+	targetFilter = &addressFilter{allow: allow, block: block}
+
+	ch := make(chan ScanTarget, 64)
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/28")
+	emitTargets(ipnet, PortList{{First: 80, Last: 81}}, ScanTarget{}, ch)
+	emitTargets(nil, nil, ScanTarget{Domain: "example.com"}, ch)
+	close(ch)
+	var got []string
+	for target := range ch {
+		got = append(got, target.String())
+	}
+	checkTargets(t, got, []string{
+		"10.0.0.0 port:80", "10.0.0.0 port:81",
+		"10.0.0.1 port:80", "10.0.0.1 port:81",
+		"10.0.0.3 port:80", "10.0.0.3 port:81",
+		"10.0.0.4 port:80", "10.0.0.4 port:81",
+		"10.0.0.5 port:80", "10.0.0.5 port:81",
+		// A domain is checked once it is resolved, when it is dialed.
+		"example.com",
+	})
+	if excluded := *GetExcludedTargets(); excluded != 22 {
+		t.Errorf("expected 22 excluded targets, got %d", excluded)
+	}
+}
+
+func TestTargetFilterDial(t *testing.T) {
+	defer func(filter *addressFilter) {
+		targetFilter = filter
+	}(targetFilter)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	address := net.JoinHostPort("localhost", port)
+
+	allow, _ := readPrefixTree(strings.NewReader("10.0.0.0/29\n"))
+	targetFilter = &addressFilter{allow: allow}
+	if _, err := DialTimeoutConnection("tcp", address, time.Second, 0); TryGetErrorType(err) != "address-excluded" {
+		t.Errorf("dialed a domain outside the allowlist: %v", err)
+	}
+	allow, _ = readPrefixTree(strings.NewReader("127.0.0.0/8\n::1\n"))
+	targetFilter = &addressFilter{allow: allow}
+	conn, err := DialTimeoutConnection("tcp", address, time.Second, 0)
+	if err != nil {
+		t.Fatalf("could not dial a domain inside the allowlist: %v", err)
+	}
+	conn.Close()
+
+	udpTarget := ScanTarget{Domain: "localhost"}
+	targetFilter = &addressFilter{allow: allow}
+	if conn, err := udpTarget.OpenUDP(&BaseFlags{Port: 53, Timeout: time.Second}, nil); err != nil {
+		t.Errorf("could not open UDP to a domain inside the allowlist: %v", err)
+	} else {
+		conn.Close()
+	}
+	block, _ := readPrefixTree(strings.NewReader("127.0.0.0/8\n::1\n"))
+	targetFilter = &addressFilter{block: block}
+	if _, err := udpTarget.OpenUDP(&BaseFlags{Port: 53, Timeout: time.Second}, nil); TryGetErrorType(err) != "address-excluded" {
+		t.Errorf("opened UDP to a blocked domain: %v", err)
+	}
+
+	// Through a proxy, only addresses can be checked.
+	targetFilter = &addressFilter{allow: allow}
+	tests := map[string]error{
+		"127.0.0.1:80":   nil,
+		"10.0.0.1:80":    ErrAddressExcluded,
+		"example.com:80": ErrAddressExcluded,
+	}
+	for address, expected := range tests {
+		if err := checkProxiedAddress(address); err != expected {
+			t.Errorf("%s: got %v, expected %v", address, err, expected)
+		}
+	}
+	if excluded := *GetExcludedTargets(); excluded != 0 {
+		t.Errorf("refused connections were counted as %d excluded targets", excluded)
+	}
+}
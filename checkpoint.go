@@ -0,0 +1,294 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Checkpoint records the progress of a scan, so that an interrupted scan can
+// be resumed (see --checkpoint-file and --resume).
+//
+// Targets are numbered in the order the input delivers them, so resuming
+// requires the same input and options. Every target numbered below Offset
+// has been scanned and its results written. Of the targets numbered from
+// Offset up to Next, those listed in InFlight were still being scanned when
+// the checkpoint was written; the rest were done.
+type Checkpoint struct {
+	Input    string           `json:"input"`
+	Offset   uint64           `json:"offset"`
+	Next     uint64           `json:"next"`
+	InFlight []InFlightTarget `json:"in_flight"`
+	Time     string           `json:"time"`
+	Complete bool             `json:"complete,omitempty"`
+	// Seed is the --randomize seed, which resuming must reuse.
+	Seed     int64 `json:"seed,omitempty"`
+	inFlight map[uint64]bool
+}
+
+// InFlightTarget is a target that was being scanned when a Checkpoint was
+// written.
+type InFlightTarget struct {
+	Index  uint64 `json:"index"`
+	Target string `json:"target"`
+}
+
+// LoadCheckpoint reads a checkpoint file.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ret Checkpoint
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file %s: %v", path, err)
+	}
+	ret.inFlight = make(map[uint64]bool, len(ret.InFlight))
+	for _, t := range ret.InFlight {
+		ret.inFlight[t.Index] = true
+	}
+	return &ret, nil
+}
+
+// done reports whether the checkpoint shows the target with the given index
+// as scanned.
+func (c *Checkpoint) done(index uint64) bool {
+	if index < c.Offset {
+		return true
+	}
+	return index < c.Next && !c.inFlight[index]
+}
+
+// Save writes the checkpoint to path. The file is replaced atomically, so a
+// crash while saving leaves the previous checkpoint intact.
+func (c *Checkpoint) Save(path string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// progressTracker numbers the targets as they are read from the input, and
+// follows each one until all of its results have been handed to the output.
+// A target may produce several results (one per open port with --ports, and
+// one per connection with --connections-per-host) or none at all.
+type progressTracker struct {
+	mutex sync.Mutex
+	next  uint64
+	// pending maps the index of each unfinished target to the number of
+	// results still expected from it.
+	pending map[uint64]int
+	targets map[uint64]string
+	// resume is the checkpoint being resumed, if any.
+	resume *Checkpoint
+	// last is the last result handed to the output, which may not have been
+	// written yet.
+	last     *trackedResult
+	finished bool
+}
+
+// progress is nil unless checkpointing is enabled.
+var progress *progressTracker
+
+func newProgressTracker(resume *Checkpoint) *progressTracker {
+	return &progressTracker{
+		pending: make(map[uint64]int),
+		targets: make(map[uint64]string),
+		resume:  resume,
+	}
+}
+
+// start numbers the next target read from the input. It returns false if
+// the target was already scanned according to the checkpoint being resumed,
+// in which case it must be skipped.
+func (p *progressTracker) start(target *ScanTarget) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	target.index = p.next
+	p.next++
+	if p.resume != nil && p.resume.done(target.index) {
+		return false
+	}
+	p.pending[target.index] = 1
+	p.targets[target.index] = target.String()
+	return true
+}
+
+// add records that the target will produce n more results than expected. n
+// may be negative; a target left expecting none is done.
+func (p *progressTracker) add(index uint64, n int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.pending[index] += n; p.pending[index] <= 0 {
+		delete(p.pending, index)
+		delete(p.targets, index)
+	}
+}
+
+// done records that one of the results of the target has been written, or
+// will never be produced.
+func (p *progressTracker) done(index uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.pending[index]--; p.pending[index] <= 0 {
+		delete(p.pending, index)
+		delete(p.targets, index)
+	}
+}
+
+// checkpoint returns a Checkpoint of the current progress.
+func (p *progressTracker) checkpoint() *Checkpoint {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	ret := &Checkpoint{
+		Input:    config.InputFileName,
+		Next:     p.next,
+		InFlight: []InFlightTarget{},
+		Time:     time.Now().Format(time.RFC3339),
+	}
+	if config.Randomize {
+		ret.Seed = config.Seed
+	}
+	for index := range p.pending {
+		ret.InFlight = append(ret.InFlight, InFlightTarget{Index: index, Target: p.targets[index]})
+	}
+	// When resuming, the targets not yet reached keep their state from the
+	// checkpoint being resumed.
+	if p.resume != nil {
+		if p.resume.Next > ret.Next {
+			ret.Next = p.resume.Next
+		}
+		for _, t := range p.resume.InFlight {
+			if t.Index >= p.next {
+				ret.InFlight = append(ret.InFlight, t)
+			}
+		}
+	}
+	ret.Offset = ret.Next
+	for _, t := range ret.InFlight {
+		if t.Index < ret.Offset {
+			ret.Offset = t.Index
+		}
+	}
+	ret.inFlight = make(map[uint64]bool, len(ret.InFlight))
+	for _, t := range ret.InFlight {
+		ret.inFlight[t.Index] = true
+	}
+	ret.Complete = len(ret.InFlight) == 0 && p.finished
+	sort.Slice(ret.InFlight, func(i, j int) bool {
+		return ret.InFlight[i].Index < ret.InFlight[j].Index
+	})
+	return ret
+}
+
+// numberTargets reads targets from in, numbers them, and delivers those not
+// already scanned to out, which it closes at the end.
+func (p *progressTracker) numberTargets(in <-chan ScanTarget, out chan<- ScanTarget) {
+	defer close(out)
+	for target := range in {
+		if p.start(&target) {
+			out <- target
+		}
+	}
+}
+
+// forwarded records that the result has been handed to the output. The
+// previous result has then been written, since the output writes each
+// result before reading the next; the last one is marked as done by finish,
+// once the output has returned.
+func (p *progressTracker) forwarded(r *trackedResult) {
+	p.mutex.Lock()
+	last := p.last
+	p.last = r
+	p.mutex.Unlock()
+	if last != nil {
+		p.done(last.index)
+	}
+}
+
+// finish is called once the output has returned, and the input was read to
+// the end unless interrupted is set. It returns the final checkpoint.
+func (p *progressTracker) finish(interrupted bool) *Checkpoint {
+	p.mutex.Lock()
+	last := p.last
+	p.last = nil
+	p.finished = !interrupted
+	p.mutex.Unlock()
+	if last != nil {
+		p.done(last.index)
+	}
+	return p.checkpoint()
+}
+
+// writeCheckpoints saves a checkpoint every interval until stop is closed.
+func (p *progressTracker) writeCheckpoints(path string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.checkpoint().Save(path); err != nil {
+				log.Errorf("could not write checkpoint: %s", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// trimPartialLine truncates f after its last newline, discarding a result
+// that was only partly written when the previous scan was interrupted.
+func trimPartialLine(f *os.File) error {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil || size == 0 {
+		return err
+	}
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] == '\n' {
+				if start+int64(i)+1 == size {
+					return nil
+				}
+				return f.Truncate(start + int64(i) + 1)
+			}
+		}
+		end = start
+	}
+	return f.Truncate(0)
+}
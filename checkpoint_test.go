@@ -0,0 +1,149 @@
+package zgrab2
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// numberTestTargets runs count targets through the tracker's numbering
+// stage, and returns the indexes of those it passes on.
+func numberTestTargets(p *progressTracker, count int) []uint64 {
+	in := make(chan ScanTarget, count)
+	out := make(chan ScanTarget, count)
+	for i := 0; i < count; i++ {
+		in <- ScanTarget{IP: net.IPv4(10, 0, 0, byte(i))}
+	}
+	close(in)
+	p.numberTargets(in, out)
+	var ret []uint64
+	for target := range out {
+		ret = append(ret, target.index)
+	}
+	return ret
+}
+
+func TestCheckpointResume(t *testing.T) {
+	p := newProgressTracker(nil)
+	if started := numberTestTargets(p, 10); len(started) != 10 {
+		t.Fatalf("expected all targets to start, got %v", started)
+	}
+	// Targets 0-2 and 5 are done; 4 expects a second result.
+	p.add(4, 1)
+	for _, index := range []uint64{0, 1, 2, 4, 5} {
+		p.done(index)
+	}
+	checkpoint := p.checkpoint()
+	if checkpoint.Offset != 3 || checkpoint.Next != 10 || checkpoint.Complete {
+		t.Errorf("wrong checkpoint: %+v", checkpoint)
+	}
+	var inFlight []uint64
+	for _, target := range checkpoint.InFlight {
+		inFlight = append(inFlight, target.Index)
+	}
+	if !reflect.DeepEqual(inFlight, []uint64{3, 4, 6, 7, 8, 9}) {
+		t.Errorf("wrong in-flight targets: %v", inFlight)
+	}
+	if checkpoint.InFlight[0].Target != "10.0.0.3" {
+		t.Errorf("wrong in-flight target: %+v", checkpoint.InFlight[0])
+	}
+
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+	if err := checkpoint.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resume, with more input than before, and stop after target 7.
+	p = newProgressTracker(loaded)
+	if started := numberTestTargets(p, 8); !reflect.DeepEqual(started, []uint64{3, 4, 6, 7}) {
+		t.Errorf("wrong targets resumed: %v", started)
+	}
+	for _, index := range []uint64{3, 4, 6} {
+		p.done(index)
+	}
+	checkpoint = p.checkpoint()
+	inFlight = nil
+	for _, target := range checkpoint.InFlight {
+		inFlight = append(inFlight, target.Index)
+	}
+	if checkpoint.Offset != 7 || checkpoint.Next != 10 || !reflect.DeepEqual(inFlight, []uint64{7, 8, 9}) {
+		t.Errorf("wrong checkpoint after resuming: %+v", checkpoint)
+	}
+
+	// Finish the resumed scan.
+	p = newProgressTracker(checkpoint)
+	started := numberTestTargets(p, 12)
+	if !reflect.DeepEqual(started, []uint64{7, 8, 9, 10, 11}) {
+		t.Errorf("wrong targets resumed: %v", started)
+	}
+	for _, index := range started {
+		p.done(index)
+	}
+	if checkpoint = p.finish(false); !checkpoint.Complete || checkpoint.Offset != 12 || len(checkpoint.InFlight) != 0 {
+		t.Errorf("wrong final checkpoint: %+v", checkpoint)
+	}
+}
+
+func TestForwardResults(t *testing.T) {
+	p := newProgressTracker(nil)
+	numberTestTargets(p, 2)
+	in := make(chan trackedResult, 2)
+	out := make(chan []byte)
+	in <- trackedResult{index: 0, result: []byte("a")}
+	in <- trackedResult{index: 1, result: []byte("b")}
+	close(in)
+	progress = p
+	defer func() { progress = nil }()
+	go forwardResults(in, out, make(chan struct{}))
+	<-out
+	<-out
+	for range out {
+	}
+	// The last result is only done once the output has returned.
+	if checkpoint := p.checkpoint(); checkpoint.Offset != 1 {
+		t.Errorf("expected target 1 to be in flight, got %+v", checkpoint)
+	}
+	if checkpoint := p.finish(false); checkpoint.Offset != 2 || !checkpoint.Complete {
+		t.Errorf("expected all targets to be done, got %+v", checkpoint)
+	}
+}
+
+func TestTrimPartialLine(t *testing.T) {
+	tests := []struct {
+		contents string
+		expected string
+	}{
+		{"", ""},
+		{"{\"ip\":\"10.0.0.1\"}\n", "{\"ip\":\"10.0.0.1\"}\n"},
+		{"{\"ip\":\"10.0.0.1\"}\n{\"ip\":\"10.0", "{\"ip\":\"10.0.0.1\"}\n"},
+		{"{\"ip\":\"10.0", ""},
+	}
+	for _, test := range tests {
+		f, err := ioutil.TempFile("", "output")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(test.contents)
+		if err := trimPartialLine(f); err != nil {
+			t.Error(err)
+		}
+		f.Close()
+		contents, _ := ioutil.ReadFile(f.Name())
+		os.Remove(f.Name())
+		if string(contents) != test.expected {
+			t.Errorf("wrong contents after trimming %q (got %q; expected %q)", test.contents, contents, test.expected)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package zgrab2
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// concurrencyLimiter caps the number of connections open at once to each
+// key (a host, or a network prefix).
+type concurrencyLimiter struct {
+	mutex sync.Mutex
+	limit int
+	slots map[string]*keySlots
+}
+
+// keySlots is a semaphore for a single key, along with the number of
+// connections holding or waiting for it, so that idle keys can be dropped.
+type keySlots struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newConcurrencyLimiter(limit int) *concurrencyLimiter {
+	return &concurrencyLimiter{limit: limit, slots: make(map[string]*keySlots)}
+}
+
+// acquire waits until a connection to key can be opened, or ctx is done.
+func (l *concurrencyLimiter) acquire(ctx context.Context, key string) error {
+	l.mutex.Lock()
+	slots := l.slots[key]
+	if slots == nil {
+		slots = &keySlots{ch: make(chan struct{}, l.limit)}
+		l.slots[key] = slots
+	}
+	slots.refs++
+	l.mutex.Unlock()
+	select {
+	case slots.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		l.unref(key, slots)
+		return ctx.Err()
+	}
+}
+
+// release frees a slot acquired for key.
+func (l *concurrencyLimiter) release(key string) {
+	l.mutex.Lock()
+	slots := l.slots[key]
+	l.mutex.Unlock()
+	<-slots.ch
+	l.unref(key, slots)
+}
+
+func (l *concurrencyLimiter) unref(key string, slots *keySlots) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if slots.refs--; slots.refs == 0 {
+		delete(l.slots, key)
+	}
+}
+
+// prefixLimit is a parsed --max-concurrent-per-prefix option.
+type prefixLimit struct {
+	mask    net.IPMask
+	limiter *concurrencyLimiter
+}
+
+// parsePrefixLimit parses a limit of the form /LEN:N, allowing N
+// connections at once to each network of prefix length LEN, for addresses of
+// the given bit length (32 or 128).
+func parsePrefixLimit(spec string, bits int) (*prefixLimit, error) {
+	parts := strings.SplitN(strings.TrimPrefix(spec, "/"), ":", 2)
+	if !strings.HasPrefix(spec, "/") || len(parts) != 2 {
+		return nil, fmt.Errorf("invalid prefix limit %q, expected /LEN:N", spec)
+	}
+	length, err := strconv.Atoi(parts[0])
+	if err != nil || length < 0 || length > bits {
+		return nil, fmt.Errorf("invalid prefix length in %q", spec)
+	}
+	limit, err := strconv.Atoi(parts[1])
+	if err != nil || limit <= 0 {
+		return nil, fmt.Errorf("invalid limit in %q", spec)
+	}
+	return &prefixLimit{mask: net.CIDRMask(length, bits), limiter: newConcurrencyLimiter(limit)}, nil
+}
+
+// hostLimiter, prefixLimit4 and prefixLimit6 enforce
+// --max-concurrent-per-host and --max-concurrent-per-prefix(6). They are nil
+// if unlimited.
+var (
+	hostLimiter  *concurrencyLimiter
+	prefixLimit4 *prefixLimit
+	prefixLimit6 *prefixLimit
+)
+
+// resolveForSlots returns address with its host looked up, if it is a name
+// and a --max-concurrent-per-prefix(6) limit is set, so that the slot is
+// taken for the network actually dialed. The connection is then made to the
+// first address found, without falling back to the others. A name sent to a
+// proxy is left for the proxy to look up, and is not limited by prefix. The
+// lookup uses the resolver of d, and is bounded by its timeout.
+func resolveForSlots(ctx context.Context, d *net.Dialer, network, address string) (string, error) {
+	if (prefixLimit4 == nil && prefixLimit6 == nil) || len(proxies) > 0 {
+		return address, nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return address, nil
+	}
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+	family := "ip"
+	if strings.HasSuffix(network, "4") || strings.HasSuffix(network, "6") {
+		family += network[len(network)-1:]
+	}
+	ips, err := resolver.LookupIP(ctx, family, host)
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+// acquireDialSlots waits until a connection to address (host:port) can be
+// opened within the concurrency limits, or ctx is done. On success, it
+// returns a function that must be called once the connection is closed. The
+// prefix limits only apply to an address given as an IP; see
+// resolveForSlots.
+func acquireDialSlots(ctx context.Context, address string) (func(), error) {
+	if hostLimiter == nil && prefixLimit4 == nil && prefixLimit6 == nil {
+		return func() {}, nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	var releases []func()
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+	// The prefix is always acquired before the host, so that connections
+	// waiting for one never hold the other in the opposite order.
+	if ip := net.ParseIP(host); ip != nil {
+		limit := prefixLimit6
+		if ip.To4() != nil {
+			ip, limit = ip.To4(), prefixLimit4
+		}
+		if limit != nil {
+			key := ip.Mask(limit.mask).String()
+			if err := limit.limiter.acquire(ctx, key); err != nil {
+				return nil, err
+			}
+			releases = append(releases, func() { limit.limiter.release(key) })
+		}
+	}
+	if hostLimiter != nil {
+		if err := hostLimiter.acquire(ctx, host); err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, func() { hostLimiter.release(host) })
+	}
+	return release, nil
+}
@@ -0,0 +1,158 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParsePrefixLimit(t *testing.T) {
+	tests := []struct {
+		spec  string
+		bits  int
+		valid bool
+	}{
+		{"/24:16", 32, true},
+		{"/64:4", 128, true},
+		{"24:16", 32, false},
+		{"/33:16", 32, false},
+		{"/24:0", 32, false},
+		{"/24", 32, false},
+	}
+	for _, test := range tests {
+		if _, err := parsePrefixLimit(test.spec, test.bits); (err == nil) != test.valid {
+			t.Errorf("parsePrefixLimit(%q): unexpected error %v", test.spec, err)
+		}
+	}
+}
+
+// tryAcquire reports whether the slots for address can be acquired within a
+// short time, and returns the release function if so.
+func tryAcquire(address string) (func(), bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	release, err := acquireDialSlots(ctx, address)
+	return release, err == nil
+}
+
+func TestAcquireDialSlots(t *testing.T) {
+	defer func() {
+		hostLimiter, prefixLimit4 = nil, nil
+	}()
+	hostLimiter = newConcurrencyLimiter(1)
+	prefixLimit4, _ = parsePrefixLimit("/24:2", 32)
+
+	releaseA, ok := tryAcquire("10.0.0.1:80")
+	if !ok {
+		t.Fatal("first connection to 10.0.0.1 blocked")
+	}
+	if _, ok := tryAcquire("10.0.0.1:443"); ok {
+		t.Error("second connection to 10.0.0.1 allowed")
+	}
+	releaseB, ok := tryAcquire("10.0.0.2:80")
+	if !ok {
+		t.Fatal("first connection to 10.0.0.2 blocked")
+	}
+	if _, ok := tryAcquire("10.0.0.3:80"); ok {
+		t.Error("third connection to 10.0.0.0/24 allowed")
+	}
+	releaseC, ok := tryAcquire("10.0.1.1:80")
+	if !ok {
+		t.Error("connection to another /24 blocked")
+	}
+	releaseA()
+	releaseD, ok := tryAcquire("10.0.0.3:80")
+	if !ok {
+		t.Error("connection to 10.0.0.3 blocked after a release")
+	}
+	releaseB()
+	releaseC()
+	releaseD()
+	if n := len(hostLimiter.slots) + len(prefixLimit4.limiter.slots); n != 0 {
+		t.Errorf("expected idle keys to be dropped, %d remain", n)
+	}
+}
+
+func TestDialWaitsForSlotOutsideConnectTimeout(t *testing.T) {
+	defer func() {
+		hostLimiter = nil
+	}()
+	hostLimiter = newConcurrencyLimiter(1)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	// Another connection holds the host's only slot for longer than the
+	// connect timeout.
+	release, ok := tryAcquire(l.Addr().String())
+	if !ok {
+		t.Fatal("slot blocked")
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		release()
+	}()
+	d := NewDialer(&Dialer{Timeout: 5 * time.Second, ConnectTimeout: 50 * time.Millisecond})
+	conn, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed while waiting for a slot: %v", err)
+	}
+	conn.Close()
+}
+
+func TestDialLimitsDomainsByPrefix(t *testing.T) {
+	defer func() {
+		prefixLimit4 = nil
+	}()
+	prefixLimit4, _ = parsePrefixLimit("/24:1", 32)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	fake, _ := NewFakeResolver("127.0.0.1")
+	dial := func() error {
+		d := NewDialer(&Dialer{Timeout: 50 * time.Millisecond})
+		d.Dialer.Resolver = fake
+		conn, err := d.DialContext(context.Background(), "tcp", net.JoinHostPort("scan.invalid", port))
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	// Another connection holds the only slot for 127.0.0.0/24.
+	release, ok := tryAcquire("127.0.0.2:80")
+	if !ok {
+		t.Fatal("slot blocked")
+	}
+	if err := dial(); err == nil {
+		t.Error("dial to a domain in a full prefix was allowed")
+	}
+	release()
+	if err := dial(); err != nil {
+		t.Errorf("dial failed after the slot was released: %v", err)
+	}
+	if n := len(prefixLimit4.limiter.slots); n != 0 {
+		t.Errorf("expected idle keys to be dropped, %d remain", n)
+	}
+}
@@ -1,10 +1,12 @@
 package zgrab2
 
 import (
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
@@ -13,25 +15,66 @@ import (
 // Config is the high level framework options that will be parsed
 // from the command line
 type Config struct {
-	OutputFileName     string          `short:"o" long:"output-file" default:"-" description:"Output filename, use - for stdout"`
-	InputFileName      string          `short:"f" long:"input-file" default:"-" description:"Input filename, use - for stdin"`
-	MetaFileName       string          `short:"m" long:"metadata-file" default:"-" description:"Metadata filename, use - for stderr"`
-	LogFileName        string          `short:"l" long:"log-file" default:"-" description:"Log filename, use - for stderr"`
-	Senders            int             `short:"s" long:"senders" default:"1000" description:"Number of send goroutines to use"`
-	Debug              bool            `long:"debug" description:"Include debug fields in the output."`
-	Flush              bool            `long:"flush" description:"Flush after each line of output."`
-	GOMAXPROCS         int             `long:"gomaxprocs" default:"0" description:"Set GOMAXPROCS"`
-	ConnectionsPerHost int             `long:"connections-per-host" default:"1" description:"Number of times to connect to each host (results in more output)"`
-	ReadLimitPerHost   int             `long:"read-limit-per-host" default:"96" description:"Maximum total kilobytes to read for a single host (default 96kb)"`
-	Prometheus         string          `long:"prometheus" description:"Address to use for Prometheus server (e.g. localhost:8080). If empty, Prometheus is disabled."`
-	Multiple           MultipleCommand `command:"multiple" description:"Multiple module actions"`
-	inputFile          *os.File
-	outputFile         *os.File
-	metaFile           *os.File
-	logFile            *os.File
-	inputTargets       InputTargetsFunc
-	outputResults      OutputResultsFunc
-	localAddr          *net.TCPAddr
+	OutputFileName        string          `short:"o" long:"output-file" default:"-" description:"Output filename, use - for stdout. A .gz, .zst or .zstd extension compresses the output, and {TIMESTAMP}, {NANOS}, {INDEX} and {MODULE} are replaced when rotating or splitting"`
+	InputFileName         string          `short:"f" long:"input-file" default:"-" description:"Input filename, use - for stdin"`
+	InputFormat           string          `long:"input-format" default:"csv" choice:"csv" choice:"jsonl" choice:"nmap-xml" choice:"masscan" choice:"zmap" description:"Format of the input file: zgrab2 csv or jsonl, nmap -oX, masscan -oJ, or zmap csv"`
+	OutputFormat          string          `long:"output-format" default:"json" choice:"json" choice:"nmap-xml" choice:"nmap-grepable" description:"Format of the output file: zgrab2 JSON lines, nmap -oX or nmap -oG"`
+	RotateSize            int64           `long:"rotate-size" description:"Start a new output file once the current one reaches this many bytes on disk (0 = never)"`
+	RotateRecords         int64           `long:"rotate-records" description:"Start a new output file after this many results (0 = never)"`
+	RotateInterval        time.Duration   `long:"rotate-interval" description:"Start a new output file at this interval (0 = never)"`
+	SplitByModule         bool            `long:"split-by-module" description:"Write the responses of each scanner to a separate output file, named with {MODULE} (added before the extension if missing)"`
+	MetaFileName          string          `short:"m" long:"metadata-file" default:"-" description:"Metadata filename, use - for stderr"`
+	LogFileName           string          `short:"l" long:"log-file" default:"-" description:"Log filename, use - for stderr"`
+	Senders               int             `short:"s" long:"senders" default:"1000" description:"Number of send goroutines to use"`
+	Debug                 bool            `long:"debug" description:"Include debug fields in the output."`
+	Flush                 bool            `long:"flush" description:"Flush after each line of output."`
+	GOMAXPROCS            int             `long:"gomaxprocs" default:"0" description:"Set GOMAXPROCS"`
+	ConnectionsPerHost    int             `long:"connections-per-host" default:"1" description:"Number of times to connect to each host (results in more output)"`
+	ReadLimitPerHost      int             `long:"read-limit-per-host" default:"96" description:"Maximum total kilobytes to read for a single host (default 96kb)"`
+	Prometheus            string          `long:"prometheus" description:"Address to use for Prometheus server (e.g. localhost:8080). If empty, Prometheus is disabled."`
+	Ports                 string          `long:"ports" description:"Check these TCP ports (e.g. 22,80,8000-8100) on every target with a connect sweep, and scan only the open ones"`
+	DiscoveryConcurrency  int             `long:"discovery-concurrency" default:"1000" description:"Number of connect checks to run at once with --ports"`
+	DiscoveryTimeout      time.Duration   `long:"discovery-timeout" default:"2s" description:"Time to wait for each connect check with --ports"`
+	ClosedPorts           string          `long:"closed-ports" default:"drop" choice:"drop" choice:"summary" description:"With --ports, whether to only count closed ports (drop) or break the counts down by port in the summary"`
+	Dispatch              bool            `long:"dispatch-by-port" description:"Run only the scanners whose port matches the target's port, for targets that carry a port"`
+	DispatchFile          string          `long:"dispatch-file" description:"YAML file mapping ports to the scanners to run against them, overriding the default of each scanner's port (implies --dispatch-by-port)"`
+	CheckpointFile        string          `long:"checkpoint-file" description:"Periodically record the progress of the scan in this file, so that it can be resumed with --resume (implies --flush)"`
+	CheckpointInterval    time.Duration   `long:"checkpoint-interval" default:"10s" description:"How often to write the checkpoint file"`
+	Resume                bool            `long:"resume" description:"Resume the scan recorded in --checkpoint-file, skipping the targets already scanned and appending to the output file"`
+	StatusUpdatesInterval time.Duration   `long:"status-updates-interval" description:"Write a JSON line with the progress of the scan to the metadata file at this interval (0 = never)"`
+	ShutdownGracePeriod   time.Duration   `long:"shutdown-grace-period" default:"10s" description:"On SIGINT or SIGTERM, how long to wait for the grabs in flight before writing the output and exiting"`
+	ConnectionsPerSecond  float64         `long:"connections-per-second" description:"Maximum rate of new connections (TCP and UDP) across all scanners. 0 means unlimited."`
+	BytesPerSecond        int64           `long:"bytes-per-second" description:"Maximum rate of bytes read and written across all connections. 0 means unlimited."`
+	MaxConcurrentPerHost  int             `long:"max-concurrent-per-host" description:"Maximum number of connections open at once to a single host, across all scanners. 0 means unlimited."`
+	MaxConcurrentPrefix   string          `long:"max-concurrent-per-prefix" description:"Maximum number of connections open at once to a single IPv4 network, as /LEN:N (e.g. /24:16)"`
+	MaxConcurrentPrefix6  string          `long:"max-concurrent-per-prefix6" description:"Maximum number of connections open at once to a single IPv6 network, as /LEN:N (e.g. /64:16)"`
+	Randomize             bool            `long:"randomize" description:"Scan the addresses (and ports) of each CIDR block in a pseudo-random order"`
+	Seed                  int64           `long:"seed" description:"Seed for --randomize, to reproduce the order of an earlier run (default: random)"`
+	Shard                 int             `long:"shard" default:"0" description:"Scan only this shard of the targets, numbered from 0 (see --shards)"`
+	Shards                int             `long:"shards" default:"1" description:"Split the targets, after expanding CIDR blocks and port ranges, into this many shards"`
+	BlocklistFileName     string          `long:"blocklist-file" description:"Never scan the addresses in this file of CIDR blocks (ZMap format)"`
+	AllowlistFileName     string          `long:"allowlist-file" description:"Only scan the addresses in this file of CIDR blocks (ZMap format)"`
+	Resolve               bool            `long:"resolve" description:"Look up the addresses of targets given only by their domain, and scan each address"`
+	Resolver              string          `long:"resolver" description:"DNS server (ip:port) for --resolve, which it implies; the system resolver is used otherwise"`
+	ResolveType           string          `long:"resolve-type" default:"a" choice:"a" choice:"aaaa" choice:"both" description:"Which address records --resolve looks up"`
+	ResolveConcurrency    int             `long:"resolve-concurrency" default:"100" description:"Number of DNS lookups to run at once with --resolve"`
+	ResolveTimeout        time.Duration   `long:"resolve-timeout" default:"5s" description:"Timeout for each DNS lookup with --resolve"`
+	ResolveCacheSize      int             `long:"resolve-cache-size" default:"100000" description:"Number of domains whose --resolve lookups are cached, least recently used first out (0 = unlimited)"`
+	Proxy                 string          `long:"proxy" description:"Make all connections through this proxy (socks5://[user:password@]host:port or http://[user:password@]host:port)"`
+	ProxyFile             string          `long:"proxy-file" description:"Make connections through the proxies listed in this file, one URL per line, in turn"`
+	SourceIP              string          `long:"source-ip" description:"Make connections from these local addresses (a comma-separated list of addresses and CIDR blocks)"`
+	SourceIPSelection     string          `long:"source-ip-selection" default:"round-robin" choice:"round-robin" choice:"hash" description:"Use the --source-ip addresses in turn, or pick one by a hash of the target"`
+	SourcePortRange       string          `long:"source-port-range" description:"Make TCP connections from local ports in this range (FIRST-LAST)"`
+	ConnectionInfo        bool            `long:"connection-info" description:"Add the addresses, timings and byte counts of the connections made by each scan to its response"`
+	Multiple              MultipleCommand `command:"multiple" description:"Multiple module actions"`
+	inputFile             *os.File
+	outputFile            *os.File
+	metaFile              *os.File
+	logFile               *os.File
+	inputTargets          InputTargetsFunc
+	outputResults         OutputResultsFunc
+	ports                 PortList
+	dispatchOverrides     DispatchOverrides
 }
 
 // SetInputFunc sets the target input function to the provided function.
@@ -62,7 +105,18 @@ func validateFrameworkConfiguration() {
 		}
 		log.SetOutput(config.logFile)
 	}
-	SetInputFunc(InputTargetsCSV)
+	switch config.InputFormat {
+	case "jsonl":
+		SetInputFunc(InputTargetsJSONL)
+	case "nmap-xml":
+		SetInputFunc(InputTargetsNmapXML)
+	case "masscan":
+		SetInputFunc(InputTargetsMasscan)
+	case "zmap":
+		SetInputFunc(InputTargetsZMap)
+	default:
+		SetInputFunc(InputTargetsCSV)
+	}
 
 	if config.InputFileName == "-" {
 		config.inputFile = os.Stdin
@@ -73,16 +127,105 @@ func validateFrameworkConfiguration() {
 		}
 	}
 
-	if config.OutputFileName == "-" {
+	var resume *Checkpoint
+	if config.Resume {
+		if config.CheckpointFile == "" {
+			log.Fatal("--resume requires --checkpoint-file")
+		}
+		if config.OutputFormat != "json" {
+			log.Fatalf("cannot resume with --output-format %s", config.OutputFormat)
+		}
+		var err error
+		if resume, err = LoadCheckpoint(config.CheckpointFile); os.IsNotExist(err) {
+			log.Infof("no checkpoint in %s, starting from the beginning", config.CheckpointFile)
+		} else if err != nil {
+			log.Fatal(err)
+		} else if resume.Input != config.InputFileName {
+			log.Fatalf("checkpoint %s is for input %s, not %s", config.CheckpointFile, resume.Input, config.InputFileName)
+		} else {
+			log.Infof("resuming from target %d of %s", resume.Offset, config.InputFileName)
+			if config.Randomize && config.Seed == 0 {
+				config.Seed = resume.Seed
+			}
+		}
+	}
+	if config.CheckpointFile != "" {
+		if config.CheckpointInterval <= 0 {
+			log.Fatalf("invalid checkpoint interval %s", config.CheckpointInterval)
+		}
+		// Results must reach the output file before the checkpoint can
+		// count them as written.
+		config.Flush = true
+		progress = newProgressTracker(resume)
+	}
+
+	if config.RotateSize < 0 || config.RotateRecords < 0 || config.RotateInterval < 0 {
+		log.Fatalf("invalid rotation limits")
+	}
+	rotating := config.RotateSize > 0 || config.RotateRecords > 0 || config.RotateInterval > 0
+	compressed := config.OutputFileName != "-" && isCompressedName(config.OutputFileName)
+	if rotating || config.SplitByModule {
+		if config.OutputFileName == "-" {
+			log.Fatalf("rotating or splitting the output requires an --output-file")
+		}
+		if config.OutputFormat != "json" {
+			log.Fatalf("cannot rotate or split --output-format %s", config.OutputFormat)
+		}
+	}
+	if (rotating || config.SplitByModule || compressed) && config.CheckpointFile != "" {
+		log.Fatalf("cannot checkpoint a compressed, rotated or split output file")
+	}
+
+	if rotating || config.SplitByModule || (compressed && config.OutputFormat == "json") {
+		sink, err := newOutputSink(config.OutputFileName, config.RotateSize, config.RotateRecords, config.RotateInterval, config.SplitByModule)
+		if err != nil {
+			log.Fatal(err)
+		}
+		SetOutputFunc(sink.output)
+	} else if config.OutputFileName == "-" {
 		config.outputFile = os.Stdout
+	} else if resume != nil {
+		var err error
+		if config.outputFile, err = os.OpenFile(config.OutputFileName, os.O_RDWR|os.O_CREATE, 0666); err != nil {
+			log.Fatal(err)
+		}
+		// Drop a result cut short by the interruption; the checkpoint does not
+		// count it as written.
+		if err = trimPartialLine(config.outputFile); err != nil {
+			log.Fatal(err)
+		}
+		if _, err = config.outputFile.Seek(0, io.SeekEnd); err != nil {
+			log.Fatal(err)
+		}
 	} else {
 		var err error
 		if config.outputFile, err = os.Create(config.OutputFileName); err != nil {
 			log.Fatal(err)
 		}
 	}
-	outputFunc := OutputResultsWriterFunc(config.outputFile)
-	SetOutputFunc(outputFunc)
+	if config.outputFile != nil {
+		var w io.Writer = config.outputFile
+		compressor, err := newCompressor(config.OutputFileName, config.outputFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if compressor != nil {
+			w = compressor
+		}
+		var f OutputResultsFunc
+		switch config.OutputFormat {
+		case "nmap-xml":
+			f = OutputResultsNmapXMLFunc(w)
+		case "nmap-grepable":
+			f = OutputResultsNmapGrepableFunc(w)
+		default:
+			f = OutputResultsWriterFunc(w)
+		}
+		if compressor != nil {
+			f = closingOutputFunc(f, compressor)
+		}
+		SetOutputFunc(f)
+	}
 
 	if config.MetaFileName == "-" {
 		config.metaFile = os.Stderr
@@ -93,6 +236,10 @@ func validateFrameworkConfiguration() {
 		}
 	}
 
+	if config.StatusUpdatesInterval < 0 {
+		log.Fatalf("invalid status updates interval %s", config.StatusUpdatesInterval)
+	}
+
 	// Validate Go Runtime config
 	if config.GOMAXPROCS < 0 {
 		log.Fatalf("invalid GOMAXPROCS (must be positive, given %d)", config.GOMAXPROCS)
@@ -102,7 +249,7 @@ func validateFrameworkConfiguration() {
 	//validate/start prometheus
 	if config.Prometheus != "" {
 		go func() {
-			http.Handle("metrics", promhttp.Handler())
+			http.Handle("/metrics", promhttp.Handler())
 			if err := http.ListenAndServe(config.Prometheus, nil); err != nil {
 				log.Fatalf("could not run prometheus server: %s", err.Error())
 			}
@@ -124,6 +271,140 @@ func validateFrameworkConfiguration() {
 		log.Fatalf("connectionsPerHost must be in the range [0,50]")
 	}
 
+	// validate the port sweep
+	if config.Ports != "" {
+		var err error
+		if config.ports, err = ParsePortList(config.Ports); err != nil {
+			log.Fatalf("invalid --ports: %s", err)
+		}
+		if config.DiscoveryConcurrency <= 0 {
+			log.Fatalf("need at least one discovery goroutine, given %d", config.DiscoveryConcurrency)
+		}
+		discoveryStats = new(DiscoveryStats)
+		if config.ClosedPorts == "summary" {
+			discoveryStats.Ports = make(map[string]*PortDiscoveryStats)
+		}
+	}
+
+	// load the dispatch overrides; the table itself is built once the
+	// scanners are registered
+	if config.DispatchFile != "" {
+		var err error
+		if config.dispatchOverrides, err = LoadDispatchOverrides(config.DispatchFile); err != nil {
+			log.Fatalf("could not load dispatch file: %s", err)
+		}
+		config.Dispatch = true
+	}
+
+	// set up the rate limits, allowing bursts of up to one second's worth
+	if config.ConnectionsPerSecond < 0 || config.BytesPerSecond < 0 {
+		log.Fatalf("rate limits must not be negative")
+	}
+	if config.ConnectionsPerSecond > 0 {
+		connectLimiter = newTokenBucket(config.ConnectionsPerSecond, config.ConnectionsPerSecond)
+	}
+	if config.BytesPerSecond > 0 {
+		bytesLimiter = newTokenBucket(float64(config.BytesPerSecond), float64(config.BytesPerSecond))
+	}
+
+	// set up the concurrency limits
+	if config.MaxConcurrentPerHost < 0 {
+		log.Fatalf("invalid --max-concurrent-per-host %d", config.MaxConcurrentPerHost)
+	}
+	if config.MaxConcurrentPerHost > 0 {
+		hostLimiter = newConcurrencyLimiter(config.MaxConcurrentPerHost)
+	}
+	if config.MaxConcurrentPrefix != "" {
+		var err error
+		if prefixLimit4, err = parsePrefixLimit(config.MaxConcurrentPrefix, 32); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if config.MaxConcurrentPrefix6 != "" {
+		var err error
+		if prefixLimit6, err = parsePrefixLimit(config.MaxConcurrentPrefix6, 128); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// validate sharding
+	if config.Shards < 1 || config.Shard < 0 || config.Shard >= config.Shards {
+		log.Fatalf("invalid shard %d of %d", config.Shard, config.Shards)
+	}
+
+	// load the allowlist and blocklist
+	if config.AllowlistFileName != "" || config.BlocklistFileName != "" {
+		targetFilter = new(addressFilter)
+		if config.AllowlistFileName != "" {
+			allow, err := loadPrefixTree(config.AllowlistFileName)
+			if err != nil {
+				log.Fatalf("could not read allowlist: %s", err)
+			}
+			targetFilter.allow = allow
+		}
+		if config.BlocklistFileName != "" {
+			block, err := loadPrefixTree(config.BlocklistFileName)
+			if err != nil {
+				log.Fatalf("could not read blocklist: %s", err)
+			}
+			targetFilter.block = block
+		}
+	}
+
+	// set up the resolution stage
+	if config.Resolver != "" {
+		if _, _, err := net.SplitHostPort(config.Resolver); err != nil {
+			log.Fatalf("invalid resolver %q: %s", config.Resolver, err)
+		}
+		config.Resolve = true
+	}
+	if config.Resolve {
+		if config.ResolveConcurrency <= 0 {
+			log.Fatalf("resolve concurrency must be positive")
+		}
+		if config.ResolveCacheSize < 0 {
+			log.Fatalf("resolve cache size must not be negative")
+		}
+		resolver = newTargetResolver(config.Resolver, config.ResolveType, config.ResolveTimeout, config.ResolveCacheSize)
+	}
+
+	// set up the proxies
+	if config.Proxy != "" && config.ProxyFile != "" {
+		log.Fatalf("--proxy and --proxy-file are mutually exclusive")
+	}
+	if config.Proxy != "" {
+		proxy, err := parseProxy(config.Proxy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		proxies = append(proxies, proxy)
+	}
+	if config.ProxyFile != "" {
+		var err error
+		if proxies, err = loadProxies(config.ProxyFile); err != nil {
+			log.Fatalf("could not read proxies: %s", err)
+		}
+	}
+
+	// set up the source addresses
+	if config.SourceIP != "" || config.SourcePortRange != "" {
+		sources = &sourceAddresses{hash: config.SourceIPSelection == "hash"}
+		var err error
+		if sources.ips4, sources.ips6, err = parseSourceIPs(config.SourceIP); err != nil {
+			log.Fatalf("invalid source IP: %s", err)
+		}
+		if config.SourcePortRange != "" {
+			if sources.firstPort, sources.lastPort, err = parsePortRange(config.SourcePortRange); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	// pick a seed for --randomize, so that the summary can record it
+	if config.Randomize && config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+
 	// Stop even third-party libraries from performing unbounded reads on untrusted hosts
 	if config.ReadLimitPerHost > 0 {
 		DefaultBytesReadLimit = config.ReadLimitPerHost * 1024
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -60,6 +61,22 @@ type TimeoutConnection struct {
 	explicitReadDeadline    bool
 	explicitWriteDeadline   bool
 	explicitDeadline        bool
+	release                 func()
+	closed                  chan struct{}
+
+	// connected is when the connection was made, and dialDuration how long
+	// it took. firstByte is how long after connected the first byte was
+	// read, or zero. closedAt is when the connection was first closed, if it
+	// was; closeOnce guards it, since a connection may be closed concurrently.
+	connected    time.Time
+	dialDuration time.Duration
+	firstByte    time.Duration
+	closedAt     time.Time
+	closeOnce    sync.Once
+	// tlsDuration is the time spent in TLS handshakes over the connection.
+	tlsDuration time.Duration
+	// truncated is set once a read is cut short by the BytesReadLimit.
+	truncated bool
 }
 
 // TimeoutConnection.Read calls Read() on the underlying connection, using any configured deadlines
@@ -71,6 +88,11 @@ func (c *TimeoutConnection) Read(b []byte) (n int, err error) {
 	if c.BytesRead+len(b) >= c.BytesReadLimit {
 		b = b[0 : c.BytesReadLimit-c.BytesRead]
 	}
+	// Wait on --bytes-per-second before the deadline is set, so that the
+	// wait does not use up the read timeout.
+	if err = bytesLimiter.wait(c.ctx); err != nil {
+		return 0, err
+	}
 	if c.explicitReadDeadline || c.explicitDeadline {
 		c.explicitReadDeadline = false
 		c.explicitDeadline = false
@@ -80,9 +102,14 @@ func (c *TimeoutConnection) Read(b []byte) (n int, err error) {
 		}
 	}
 	n, err = c.Conn.Read(b)
+	if n > 0 && c.BytesRead == 0 {
+		c.firstByte = time.Since(c.connected)
+	}
 	c.BytesRead += n
+	bytesLimiter.take(float64(n))
 	if err == nil && origSize != len(b) && n == len(b) {
 		// we had to shrink the output buffer AND we used up the whole shrunk size, AND we're not at EOF
+		c.truncated = true
 		switch c.ReadLimitExceededAction {
 		case ReadLimitExceededActionTruncate:
 			logrus.Debugf("Truncated read from %d bytes to %d bytes (hit limit of %d bytes)", origSize, n, c.BytesReadLimit)
@@ -103,6 +130,9 @@ func (c *TimeoutConnection) Write(b []byte) (n int, err error) {
 	if err := c.checkContext(); err != nil {
 		return 0, err
 	}
+	if err = bytesLimiter.wait(c.ctx); err != nil {
+		return 0, err
+	}
 	if c.explicitWriteDeadline || c.explicitDeadline {
 		c.explicitWriteDeadline = false
 		c.explicitDeadline = false
@@ -113,6 +143,7 @@ func (c *TimeoutConnection) Write(b []byte) (n int, err error) {
 	}
 	n, err = c.Conn.Write(b)
 	c.BytesWritten += n
+	bytesLimiter.take(float64(n))
 	return n, err
 }
 
@@ -173,9 +204,35 @@ func GetTimeoutDialFunc(timeout time.Duration) func(string, string) (net.Conn, e
 
 // Close the underlying connection.
 func (c *TimeoutConnection) Close() error {
+	c.closeOnce.Do(func() {
+		c.closedAt = time.Now()
+	})
+	if c.release != nil {
+		c.release()
+	}
 	return c.Conn.Close()
 }
 
+// releaseOnClose arranges for release to be called once, when the connection
+// is closed or its session times out (in case it is never closed).
+func (c *TimeoutConnection) releaseOnClose(release func()) {
+	var once sync.Once
+	c.closed = make(chan struct{})
+	c.release = func() {
+		once.Do(func() {
+			close(c.closed)
+			release()
+		})
+	}
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			c.release()
+		case <-c.closed:
+		}
+	}()
+}
+
 // Get the timeout for the given field, falling back to the global timeout.
 func (c *TimeoutConnection) getTimeout(field time.Duration) time.Duration {
 	if field == 0 {
@@ -224,6 +281,7 @@ func NewTimeoutConnection(ctx context.Context, conn net.Conn, timeout, readTimeo
 		ReadTimeout:    readTimeout,
 		WriteTimeout:   writeTimeout,
 		BytesReadLimit: bytesReadLimit,
+		connected:      time.Now(),
 	}).SetDefaults()
 	if ctx == nil {
 		ctx = context.Background()
@@ -234,20 +292,39 @@ func NewTimeoutConnection(ctx context.Context, conn net.Conn, timeout, readTimeo
 
 // DialTimeoutConnectionEx dials the target and returns a net.Conn that uses the configured timeouts for Read/Write operations.
 func DialTimeoutConnectionEx(proto string, target string, dialTimeout, sessionTimeout, readTimeout, writeTimeout time.Duration, bytesReadLimit int) (net.Conn, error) {
+	return dialTimeoutConnectionFrom(sources.pick(hostOf(target)), proto, target, dialTimeout, sessionTimeout, readTimeout, writeTimeout, bytesReadLimit)
+}
+
+// dialTimeoutConnectionFrom is DialTimeoutConnectionEx, dialing from the
+// given local address (or any, if nil).
+func dialTimeoutConnectionFrom(source net.IP, proto string, target string, dialTimeout, sessionTimeout, readTimeout, writeTimeout time.Duration, bytesReadLimit int) (net.Conn, error) {
 	var conn net.Conn
-	var err error
-	if dialTimeout > 0 {
-		conn, err = net.DialTimeout(proto, target, dialTimeout)
-	} else {
-		conn, err = net.DialTimeout(proto, target, sessionTimeout)
+	dialer := &net.Dialer{Timeout: dialTimeout, LocalAddr: localAddr(proto, source)}
+	if dialTimeout <= 0 {
+		dialer.Timeout = sessionTimeout
+	}
+	target, err := resolveForSlots(context.Background(), dialer, proto, target)
+	if err != nil {
+		return nil, err
 	}
+	release, err := acquireDialSlots(context.Background(), target)
+	if err != nil {
+		return nil, err
+	}
+	waitToConnect(context.Background())
+	start := time.Now()
+	conn, err = dialFromSource(context.Background(), dialer, proto, target)
 	if err != nil {
 		if conn != nil {
 			conn.Close()
 		}
+		release()
 		return nil, err
 	}
-	return NewTimeoutConnection(context.Background(), conn, sessionTimeout, readTimeout, writeTimeout, bytesReadLimit), nil
+	ret := NewTimeoutConnection(context.Background(), conn, sessionTimeout, readTimeout, writeTimeout, bytesReadLimit)
+	ret.dialDuration = ret.connected.Sub(start)
+	ret.releaseOnClose(release)
+	return ret, nil
 }
 
 // DialTimeoutConnection dials the target and returns a net.Conn that uses the configured single timeout for all operations.
@@ -281,6 +358,10 @@ type Dialer struct {
 	// ReadLimitExceededAction describes how connections dialed with this dialer deal with exceeding
 	// the BytesReadLimit.
 	ReadLimitExceededAction ReadLimitExceededAction
+
+	// SourceIP is the local address to dial from. If nil, one is chosen from
+	// the --source-ip addresses, if any.
+	SourceIP net.IP
 }
 
 func (d *Dialer) getTimeout(field time.Duration) time.Duration {
@@ -299,16 +380,38 @@ func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.
 	d.Dialer.Timeout = d.getTimeout(d.ConnectTimeout)
 	d.Dialer.KeepAlive = d.Timeout
 
-	// Copy over the source IP if set, or nil
-	d.Dialer.LocalAddr = config.localAddr
+	// Dial from the given source IP, or one chosen from --source-ip
+	source := d.SourceIP
+	if source == nil {
+		source = sources.pick(hostOf(address))
+	}
+	d.Dialer.LocalAddr = localAddr(network, source)
 
+	address, err := resolveForSlots(ctx, d.Dialer, network, address)
+	if err != nil {
+		return nil, err
+	}
+	release, err := acquireDialSlots(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	if err := waitToConnect(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	// The connect timeout starts once the connection may be made, so that
+	// waiting for a slot or on the rate limit does not count against it.
 	dialContext, cancelDial := context.WithTimeout(ctx, d.Dialer.Timeout)
 	defer cancelDial()
-	conn, err := d.Dialer.DialContext(dialContext, network, address)
+	start := time.Now()
+	conn, err := dialFromSource(dialContext, d.Dialer, network, address)
 	if err != nil {
+		release()
 		return nil, err
 	}
 	ret := NewTimeoutConnection(ctx, conn, d.Timeout, d.ReadTimeout, d.WriteTimeout, d.BytesReadLimit)
+	ret.dialDuration = ret.connected.Sub(start)
+	ret.releaseOnClose(release)
 	ret.BytesReadLimit = d.BytesReadLimit
 	ret.ReadLimitExceededAction = d.ReadLimitExceededAction
 	return ret, nil
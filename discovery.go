@@ -0,0 +1,155 @@
+package zgrab2
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DiscoveryStats counts the results of the TCP connect sweep run before the
+// scanners when --ports is given.
+type DiscoveryStats struct {
+	// Probed is the number of target ports checked.
+	Probed uint64 `json:"probed"`
+
+	// Open is the number of ports that accepted a connection, and were passed
+	// on to the scanners.
+	Open uint64 `json:"open"`
+
+	// Closed is the number of ports that refused the connection.
+	Closed uint64 `json:"closed"`
+
+	// Filtered is the number of ports that did not answer, or failed with
+	// some other error.
+	Filtered uint64 `json:"filtered"`
+
+	// Ports breaks the counts down by port number. It is only filled in with
+	// --closed-ports=summary.
+	Ports map[string]*PortDiscoveryStats `json:"ports,omitempty"`
+
+	mutex sync.Mutex
+}
+
+// PortDiscoveryStats counts the results of the connect sweep for a single
+// port number.
+type PortDiscoveryStats struct {
+	Open     uint64 `json:"open"`
+	Closed   uint64 `json:"closed"`
+	Filtered uint64 `json:"filtered"`
+}
+
+// discoveryStats is nil unless the discovery stage is enabled.
+var discoveryStats *DiscoveryStats
+
+// GetDiscoveryStats returns the counts of the connect sweep, or nil if it
+// was not enabled.
+func GetDiscoveryStats() *DiscoveryStats {
+	return discoveryStats
+}
+
+// record counts the result of a single check.
+func (s *DiscoveryStats) record(port uint, state string) {
+	atomic.AddUint64(&s.Probed, 1)
+	switch state {
+	case "open":
+		atomic.AddUint64(&s.Open, 1)
+	case "closed":
+		atomic.AddUint64(&s.Closed, 1)
+	default:
+		atomic.AddUint64(&s.Filtered, 1)
+	}
+	if s.Ports == nil {
+		return
+	}
+	key := fmt.Sprintf("%d", port)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	p := s.Ports[key]
+	if p == nil {
+		p = new(PortDiscoveryStats)
+		s.Ports[key] = p
+	}
+	switch state {
+	case "open":
+		p.Open++
+	case "closed":
+		p.Closed++
+	default:
+		p.Filtered++
+	}
+}
+
+// isConnectionRefused reports whether err is a dial error caused by the
+// target refusing the connection.
+func isConnectionRefused(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+		return sysErr.Err == syscall.ECONNREFUSED
+	}
+	return opErr.Err == syscall.ECONNREFUSED
+}
+
+// checkPort makes a TCP connection to the target's port, and returns the
+// nmap-style state of the port: "open", "closed" or "filtered".
+func checkPort(target *ScanTarget, timeout time.Duration) string {
+	address := net.JoinHostPort(target.Host(), fmt.Sprintf("%d", *target.Port))
+	conn, err := DialTimeoutConnection("tcp", address, timeout, 0)
+	if err == nil {
+		conn.Close()
+		return "open"
+	}
+	if isConnectionRefused(err) {
+		return "closed"
+	}
+	return "filtered"
+}
+
+// discoverOpenPorts reads targets from in, checks every port in ports on
+// each of them with a TCP connect, and delivers a target with the Port set
+// for every open port to out. A target whose Port is already set is only
+// checked on that port. Up to concurrency checks run at once. out is not
+// closed.
+func discoverOpenPorts(in <-chan ScanTarget, out chan<- ScanTarget, ports PortList, concurrency int, timeout time.Duration, stats *DiscoveryStats) {
+	checks := make(chan ScanTarget, concurrency)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for target := range checks {
+				state := checkPort(&target, timeout)
+				stats.record(*target.Port, state)
+				if state == "open" {
+					out <- target
+				} else if progress != nil {
+					progress.done(target.index)
+				}
+			}
+		}()
+	}
+	portNumbers := ports.Ports()
+	for target := range in {
+		if target.Port != nil {
+			checks <- target
+			continue
+		}
+		if progress != nil {
+			progress.add(target.index, len(portNumbers)-1)
+		}
+		for _, p := range portNumbers {
+			port := p
+			t := target
+			t.Port = &port
+			checks <- t
+		}
+	}
+	close(checks)
+	wg.Wait()
+}
@@ -0,0 +1,63 @@
+package zgrab2
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// listenLocal returns a listener on an ephemeral port, and the number of a
+// port on which nothing is listening.
+func listenLocal(t *testing.T) (net.Listener, uint) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := uint(closed.Addr().(*net.TCPAddr).Port)
+	closed.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return listener, closedPort
+}
+
+func TestDiscoverOpenPorts(t *testing.T) {
+	listener, closedPort := listenLocal(t)
+	defer listener.Close()
+	openPort := uint16(listener.Addr().(*net.TCPAddr).Port)
+	ports := PortList{{First: openPort, Last: openPort}, {First: uint16(closedPort), Last: uint16(closedPort)}}
+
+	in := make(chan ScanTarget, 2)
+	out := make(chan ScanTarget, 4)
+	in <- ScanTarget{IP: net.ParseIP("127.0.0.1"), Tag: "a"}
+	explicit := closedPort
+	in <- ScanTarget{IP: net.ParseIP("127.0.0.1"), Tag: "b", Port: &explicit}
+	close(in)
+	stats := &DiscoveryStats{Ports: make(map[string]*PortDiscoveryStats)}
+	discoverOpenPorts(in, out, ports, 4, time.Second, stats)
+	close(out)
+
+	var found []ScanTarget
+	for target := range out {
+		found = append(found, target)
+	}
+	if len(found) != 1 || found[0].Tag != "a" || *found[0].Port != uint(openPort) {
+		t.Errorf("expected only the open port of target a, got %v", found)
+	}
+	if stats.Probed != 3 || stats.Open != 1 || stats.Closed != 2 || stats.Filtered != 0 {
+		t.Errorf("wrong counts: %+v", stats)
+	}
+	if p := stats.Ports[PortList{{First: uint16(closedPort), Last: uint16(closedPort)}}.String()]; p == nil || p.Closed != 2 {
+		t.Errorf("wrong counts for the closed port: %+v", p)
+	}
+}
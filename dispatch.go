@@ -0,0 +1,150 @@
+package zgrab2
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DispatchTable maps port numbers to the scanners that run against targets
+// on that port. It lets a single run over mixed-port input (e.g. from a port
+// scan) send each target only to the scanners that speak the protocol
+// expected on its port, instead of to every scanner.
+type DispatchTable struct {
+	ports    map[uint][]string
+	fallback []string
+}
+
+// dispatch is nil unless dispatch by port is enabled.
+var dispatch *DispatchTable
+
+// moduleDefaultPorts records the default port of each module, as given to
+// AddCommand.
+var moduleDefaultPorts = make(map[string]uint)
+
+// NewDispatchTable returns a DispatchTable mapping the port of each
+// registered scanner to the scanner. The port is the one the scanner was
+// configured with (by default, the module's default port), or the module's
+// default port for scanners registered without flags.
+func NewDispatchTable() *DispatchTable {
+	t := &DispatchTable{ports: make(map[uint][]string)}
+	for _, name := range orderedScanners {
+		var port uint
+		if flags := getScanBaseFlags(name); flags != nil {
+			port = flags.Port
+		} else if p, ok := moduleDefaultPorts[name]; ok {
+			port = p
+		} else {
+			continue
+		}
+		t.ports[port] = append(t.ports[port], name)
+	}
+	return t
+}
+
+// DispatchOverrides are the entries of a dispatch file, which replace the
+// default entries for the ports they name.
+//
+// A dispatch file is a YAML map from a port list (see ParsePortList) to a
+// list of scanner names. The special key "default" lists the scanners to run
+// against ports that have no entry; without it, such targets are not scanned.
+// For example:
+//
+//	443: [tls, https, jarm]
+//	8000-8100: [http]
+//	default: [banner]
+type DispatchOverrides map[string][]string
+
+// LoadDispatchOverrides reads a dispatch file.
+func LoadDispatchOverrides(path string) (DispatchOverrides, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseDispatchOverrides(f)
+}
+
+// ParseDispatchOverrides parses the YAML contents of a dispatch file.
+func ParseDispatchOverrides(source io.Reader) (DispatchOverrides, error) {
+	data, err := ioutil.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+	var ret DispatchOverrides
+	if err := yaml.UnmarshalStrict(data, &ret); err != nil {
+		return nil, err
+	}
+	for key := range ret {
+		if key == "default" {
+			continue
+		}
+		if _, err := ParsePortList(key); err != nil {
+			return nil, fmt.Errorf("invalid dispatch entry %q: %v", key, err)
+		}
+	}
+	return ret, nil
+}
+
+// Apply replaces the entries of the table with the overrides. It returns an
+// error if an override names a scanner that is not registered.
+func (t *DispatchTable) Apply(overrides DispatchOverrides) error {
+	keys := make([]string, 0, len(overrides))
+	for key, names := range overrides {
+		for _, name := range names {
+			if scanners[name] == nil {
+				return fmt.Errorf("dispatch entry %q: unknown scanner %s", key, name)
+			}
+		}
+		keys = append(keys, key)
+	}
+	// Apply single ports after ranges, so they take precedence.
+	sort.Slice(keys, func(i, j int) bool {
+		if a, b := overrideSpan(keys[i]), overrideSpan(keys[j]); a != b {
+			return a > b
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		if key == "default" {
+			t.fallback = overrides[key]
+			continue
+		}
+		ports, _ := ParsePortList(key)
+		for _, port := range ports.Ports() {
+			t.ports[port] = overrides[key]
+		}
+	}
+	return nil
+}
+
+// overrideSpan returns the number of ports an override key covers.
+func overrideSpan(key string) int {
+	ports, err := ParsePortList(key)
+	if err != nil {
+		return 0
+	}
+	return ports.Len()
+}
+
+// Scanners returns the names of the scanners that run against the port.
+func (t *DispatchTable) Scanners(port uint) []string {
+	if names, ok := t.ports[port]; ok {
+		return names
+	}
+	return t.fallback
+}
+
+// allows reports whether the named scanner runs against the port.
+func (t *DispatchTable) allows(name string, port uint) bool {
+	for _, n := range t.Scanners(port) {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
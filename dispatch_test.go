@@ -0,0 +1,116 @@
+package zgrab2
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeScanner is a Scanner that does nothing, for tests of the framework.
+type fakeScanner struct {
+	name    string
+	trigger string
+}
+
+func (s *fakeScanner) Init(flags ScanFlags) error       { return nil }
+func (s *fakeScanner) InitPerSender(senderID int) error { return nil }
+func (s *fakeScanner) GetName() string                  { return s.name }
+func (s *fakeScanner) GetTrigger() string               { return s.trigger }
+func (s *fakeScanner) Protocol() string                 { return s.name }
+func (s *fakeScanner) Scan(t ScanTarget) (ScanStatus, interface{}, error) {
+	return SCAN_SUCCESS, nil, nil
+}
+
+// fakeFlags are the ScanFlags of a fakeScanner.
+type fakeFlags struct {
+	BaseFlags
+}
+
+func (f *fakeFlags) Validate(args []string) error { return nil }
+func (f *fakeFlags) Help() string                 { return "" }
+
+// withScanners registers a fakeScanner for each name, with BaseFlags using
+// the given port, for the duration of f.
+func withScanners(ports map[string]uint, names []string, f func()) {
+	savedScanners, savedFlags, savedOrder := scanners, scannerFlags, orderedScanners
+	defer func() {
+		scanners, scannerFlags, orderedScanners = savedScanners, savedFlags, savedOrder
+	}()
+	scanners = make(map[string]*Scanner)
+	scannerFlags = make(map[string]ScanFlags)
+	orderedScanners = nil
+	for _, name := range names {
+		RegisterScanWithFlags(name, &fakeScanner{name: name}, &fakeFlags{BaseFlags{Name: name, Port: ports[name]}})
+	}
+	f()
+}
+
+func TestDispatchTable(t *testing.T) {
+	ports := map[string]uint{"ssh": 22, "http": 80, "https": 443, "tls": 443, "banner": 80}
+	names := []string{"ssh", "http", "https", "tls", "banner"}
+	overrides, err := ParseDispatchOverrides(strings.NewReader(`
+443: [tls, https]
+8000-8100: [http]
+8080: [http, banner]
+default: [banner]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withScanners(ports, names, func() {
+		table := NewDispatchTable()
+		tests := []struct {
+			port     uint
+			expected []string
+		}{
+			{22, []string{"ssh"}},
+			{80, []string{"http", "banner"}},
+			{443, []string{"https", "tls"}},
+			{8000, nil},
+		}
+		for _, test := range tests {
+			if names := table.Scanners(test.port); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("wrong default scanners for port %d (got %v; expected %v)", test.port, names, test.expected)
+			}
+		}
+
+		if err := table.Apply(overrides); err != nil {
+			t.Fatal(err)
+		}
+		tests = []struct {
+			port     uint
+			expected []string
+		}{
+			{22, []string{"ssh"}},
+			{443, []string{"tls", "https"}},
+			{8000, []string{"http"}},
+			{8080, []string{"http", "banner"}},
+			{9000, []string{"banner"}},
+		}
+		for _, test := range tests {
+			if names := table.Scanners(test.port); !reflect.DeepEqual(names, test.expected) {
+				t.Errorf("wrong scanners for port %d (got %v; expected %v)", test.port, names, test.expected)
+			}
+		}
+		if !table.allows("banner", 8080) || table.allows("ssh", 443) {
+			t.Errorf("allows disagrees with Scanners")
+		}
+
+		if err := table.Apply(DispatchOverrides{"22": {"telnet"}}); err == nil {
+			t.Errorf("expected an error for an unknown scanner")
+		}
+	})
+}
+
+func TestParseDispatchOverridesErrors(t *testing.T) {
+	tests := []string{
+		"443: tls",
+		"https: [http]",
+		"70000: [http]",
+	}
+	for _, test := range tests {
+		if _, err := ParseDispatchOverrides(strings.NewReader(test)); err == nil {
+			t.Errorf("expected an error parsing %q", test)
+		}
+	}
+}
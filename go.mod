@@ -7,6 +7,7 @@ require (
 	github.com/go-kit/kit v0.10.0 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/hdm/jarm-go v0.0.7
+	github.com/klauspost/compress v1.17.9
 	github.com/prometheus/client_golang v1.14.0
 	github.com/prometheus/common v0.42.0 // indirect
 	github.com/prometheus/procfs v0.9.0 // indirect
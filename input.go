@@ -6,40 +6,55 @@ import (
 	"io"
 	"net"
 	"strings"
+	"sync/atomic"
 
 	log "github.com/sirupsen/logrus"
 )
 
 // ParseCSVTarget takes a record from a CSV-format input file and
-// returns the specified ipnet, domain, and tag, or an error.
+// returns the specified ipnet, domain, tag and ports, or an error.
 //
-// ZGrab2 input files have three fields:
-//   IP, DOMAIN, TAG
+// ZGrab2 input files have four fields:
+//   IP, DOMAIN, TAG, PORT
 //
 // Each line specifies a target to scan by its IP address, domain
 // name, or both, as well as an optional tag used to determine which
-// scanners will be invoked.
+// scanners will be invoked, and an optional list of ports which
+// overrides the port given on the command line.
 //
 // A CIDR block may be provided in the IP field, in which case the
 // framework expands the record into targets for every address in the
 // block.
 //
+// Ports may be given in the PORT field, or appended to the IP field as
+// IP:PORTS or [IPv6]:PORTS, or to a bare domain as DOMAIN:PORTS. In
+// either place PORTS is a single port or a list of ports and ranges, e.g.
+// 80,443,8000-8100; the framework expands the record into one target for
+// every address and port. Note that a list containing commas must be
+// quoted.
+//
 // Trailing empty fields may be omitted.
 // Comment lines begin with #, and empty lines are ignored.
 //
-func ParseCSVTarget(fields []string) (ipnet *net.IPNet, domain string, tag string, err error) {
+func ParseCSVTarget(fields []string) (ipnet *net.IPNet, domain string, tag string, ports PortList, err error) {
 	for i := range fields {
 		fields[i] = strings.TrimSpace(fields[i])
 	}
 	if len(fields) > 0 && fields[0] != "" {
-		if ip := net.ParseIP(fields[0]); ip != nil {
+		host, inlinePorts := splitHostPorts(fields[0])
+		if ip := net.ParseIP(host); ip != nil {
 			ipnet = &net.IPNet{IP: ip}
-		} else if _, cidr, er := net.ParseCIDR(fields[0]); er == nil {
+		} else if _, cidr, er := net.ParseCIDR(host); er == nil {
 			ipnet = cidr
 		} else if len(fields) != 1 {
 			err = fmt.Errorf("can't parse %q as an IP address or CIDR block", fields[0])
 			return
 		}
+		if ipnet != nil && inlinePorts != "" {
+			if ports, err = ParsePortList(inlinePorts); err != nil {
+				return
+			}
+		}
 	}
 	if len(fields) > 1 {
 		domain = fields[1]
@@ -47,15 +62,30 @@ func ParseCSVTarget(fields []string) (ipnet *net.IPNet, domain string, tag strin
 	if len(fields) > 2 {
 		tag = fields[2]
 	}
-	if len(fields) > 3 {
+	if len(fields) > 3 && fields[3] != "" {
+		if ports != nil {
+			err = fmt.Errorf("ports given in both the IP and PORT fields: %q", fields)
+			return
+		}
+		if ports, err = ParsePortList(fields[3]); err != nil {
+			return
+		}
+	}
+	if len(fields) > 4 {
 		err = fmt.Errorf("too many fields: %q", fields)
 		return
 	}
 
 	// For legacy reasons, we also allow targets of the form:
-	// DOMAIN
+	// DOMAIN or DOMAIN:PORTS
 	if ipnet == nil && len(fields) == 1 {
-		domain = fields[0]
+		var inlinePorts string
+		domain, inlinePorts = splitHostPorts(fields[0])
+		if inlinePorts != "" {
+			if ports, err = ParsePortList(inlinePorts); err != nil {
+				return
+			}
+		}
 	}
 
 	if ipnet == nil && domain == "" {
@@ -65,6 +95,29 @@ func ParseCSVTarget(fields []string) (ipnet *net.IPNet, domain string, tag strin
 	return
 }
 
+// splitHostPorts splits an IP field of the form HOST:PORTS or [HOST]:PORTS
+// into its parts. Fields without a port suffix, including bare IPv6
+// addresses, are returned unchanged with empty ports.
+func splitHostPorts(field string) (host string, ports string) {
+	if strings.HasPrefix(field, "[") {
+		if i := strings.LastIndex(field, "]"); i > 0 {
+			rest := field[i+1:]
+			if rest == "" {
+				return field[1:i], ""
+			}
+			if strings.HasPrefix(rest, ":") {
+				return field[1:i], rest[1:]
+			}
+		}
+		return field, ""
+	}
+	if strings.Count(field, ":") == 1 {
+		i := strings.Index(field, ":")
+		return field[:i], field[i+1:]
+	}
+	return field, ""
+}
+
 func incrementIP(ip net.IP) {
 	for j := len(ip) - 1; j >= 0; j-- {
 		ip[j]++
@@ -102,26 +155,124 @@ func GetTargetsCSV(source io.Reader, ch chan<- ScanTarget) error {
 		if len(fields) == 0 {
 			continue
 		}
-		ipnet, domain, tag, err := ParseCSVTarget(fields)
+		ipnet, domain, tag, ports, err := ParseCSVTarget(fields)
 		if err != nil {
 			log.Errorf("parse error, skipping: %v", err)
 			continue
 		}
-		var ip net.IP
-		if ipnet != nil {
-			if ipnet.Mask != nil {
-				// expand CIDR block into one target for each IP
-				for ip = ipnet.IP.Mask(ipnet.Mask); ipnet.Contains(ip); incrementIP(ip) {
-					ch <- ScanTarget{IP: duplicateIP(ip), Domain: domain, Tag: tag}
-				}
-				continue
-			} else {
-				ip = ipnet.IP
+		emitTargets(ipnet, ports, ScanTarget{Domain: domain, Tag: tag}, ch)
+	}
+	return nil
+}
+
+// emitTargets delivers one copy of template for each address in ipnet and
+// each port in ports. A nil ipnet or an empty port list leaves the
+// corresponding field of the template unchanged; a CIDR block is expanded
+// into every address in the block. Targets outside the shard selected by
+// --shard and --shards, or excluded by the allowlist and blocklist, are
+// skipped.
+func emitTargets(ipnet *net.IPNet, ports PortList, template ScanTarget, ch chan<- ScanTarget) {
+	if ipnet != nil && ipnet.Mask != nil {
+		if ones, bits := ipnet.Mask.Size(); ones < bits {
+			atomic.StoreUint32(&counts.expanded, 1)
+		}
+	}
+	if len(ports) > 1 || (len(ports) == 1 && ports[0].First != ports[0].Last) {
+		atomic.StoreUint32(&counts.expanded, 1)
+	}
+	if config.Randomize && ipnet != nil && ipnet.Mask != nil && emitPermutedTargets(ipnet, ports, template, ch) {
+		return
+	}
+	send := func(target ScanTarget) {
+		deliverTarget(expansionIndex, target, ch)
+		expansionIndex++
+	}
+	emit := func(ip net.IP) {
+		target := template
+		if ip != nil {
+			target.IP = ip
+		}
+		if len(ports) == 0 {
+			send(target)
+			return
+		}
+		for _, r := range ports {
+			for port := uint(r.First); port <= uint(r.Last); port++ {
+				p := port
+				target.Port = &p
+				send(target)
 			}
 		}
-		ch <- ScanTarget{IP: ip, Domain: domain, Tag: tag}
 	}
-	return nil
+	if ipnet == nil {
+		emit(nil)
+	} else if ipnet.Mask != nil {
+		// expand CIDR block into one target for each IP
+		for ip := ipnet.IP.Mask(ipnet.Mask); ipnet.Contains(ip); incrementIP(ip) {
+			emit(duplicateIP(ip))
+		}
+	} else {
+		emit(ipnet.IP)
+	}
+}
+
+// deliverTarget sends the target with the given expansion index to ch,
+// unless it is outside the shard or its address is excluded.
+func deliverTarget(index uint64, target ScanTarget, ch chan<- ScanTarget) {
+	if inShard(index) && targetFilter.allowsTarget(target.IP) {
+		ch <- target
+	}
+}
+
+// emitPermutedTargets delivers the same targets as emitTargets for a CIDR
+// block, in the pseudo-random order chosen by --seed (see
+// cyclicPermutation). Addresses and ports are permuted together. It returns
+// false, having delivered nothing, if the block is too large to permute.
+func emitPermutedTargets(ipnet *net.IPNet, ports PortList, template ScanTarget, ch chan<- ScanTarget) bool {
+	ones, size := ipnet.Mask.Size()
+	if size-ones >= 63 {
+		log.Warnf("not randomizing %s: too many addresses", ipnet)
+		return false
+	}
+	hosts := uint64(1) << uint(size-ones)
+	portNumbers := ports.Ports()
+	n := hosts
+	if len(portNumbers) > 0 {
+		n *= uint64(len(portNumbers))
+	}
+	perm, err := newCyclicPermutation(n, config.Seed)
+	if err != nil {
+		log.Warnf("not randomizing %s: %v", ipnet, err)
+		return false
+	}
+	// The targets are numbered as emitTargets numbers them, so the shard of
+	// each target does not depend on the seed.
+	first := expansionIndex
+	expansionIndex += n
+	base := ipnet.IP.Mask(ipnet.Mask)
+	perm.each(func(i uint64) {
+		index := first + i
+		target := template
+		if len(portNumbers) > 0 {
+			port := portNumbers[i%uint64(len(portNumbers))]
+			target.Port = &port
+			i /= uint64(len(portNumbers))
+		}
+		target.IP = addToIP(base, i)
+		deliverTarget(index, target, ch)
+	})
+	return true
+}
+
+// addToIP returns the address n places after ip.
+func addToIP(ip net.IP, n uint64) net.IP {
+	ret := duplicateIP(ip)
+	for j := len(ret) - 1; j >= 0 && n > 0; j-- {
+		sum := uint64(ret[j]) + n&0xff
+		ret[j] = byte(sum)
+		n = n>>8 + sum>>8
+	}
+	return ret
 }
 
 // InputTargetsFunc is a function type for target input functions.
@@ -0,0 +1,233 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// This file contains readers for the output of other scanners, so that their
+// results can be fed directly into ZGrab2. Each reader sets the Port of every
+// target it generates, and keeps the service name reported by the scanner (if
+// any), which runs the scanners triggered by that name as well as those
+// without a trigger. The protocol of the port is kept, so that a UDP port is
+// only scanned by UDP modules, and a TCP port by TCP modules.
+
+// nmapHost is the subset of an nmap -oX <host> element used to build targets.
+type nmapHost struct {
+	Addresses []struct {
+		Addr     string `xml:"addr,attr"`
+		AddrType string `xml:"addrtype,attr"`
+	} `xml:"address"`
+	Hostnames []struct {
+		Name string `xml:"name,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"hostnames>hostname"`
+	Ports []struct {
+		Protocol string `xml:"protocol,attr"`
+		PortID   uint16 `xml:"portid,attr"`
+		State    struct {
+			State string `xml:"state,attr"`
+		} `xml:"state"`
+		Service struct {
+			Name string `xml:"name,attr"`
+		} `xml:"service"`
+	} `xml:"ports>port"`
+}
+
+// InputTargetsNmapXML is an InputTargetsFunc that calls GetTargetsNmapXML
+// with the input file provided on the command line.
+func InputTargetsNmapXML(ch chan<- ScanTarget) error {
+	return GetTargetsNmapXML(config.inputFile, ch)
+}
+
+// GetTargetsNmapXML reads an nmap XML report (as written by nmap -oX),
+// and delivers a ScanTarget for every open port of every host to the provided
+// channel. The domain is taken from the user-supplied hostname, if any.
+// Hosts are decoded one at a time, so the report is never held in memory.
+func GetTargetsNmapXML(source io.Reader, ch chan<- ScanTarget) error {
+	decoder := xml.NewDecoder(source)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "host" {
+			continue
+		}
+		var host nmapHost
+		if err := decoder.DecodeElement(&host, &start); err != nil {
+			return err
+		}
+		var ip net.IP
+		for _, address := range host.Addresses {
+			if address.AddrType == "ipv4" || address.AddrType == "ipv6" {
+				ip = net.ParseIP(address.Addr)
+				break
+			}
+		}
+		var domain string
+		for _, hostname := range host.Hostnames {
+			if hostname.Type == "user" {
+				domain = hostname.Name
+				break
+			}
+		}
+		if ip == nil && domain == "" {
+			log.Errorf("parse error, skipping: nmap host has no address or hostname")
+			continue
+		}
+		var ipnet *net.IPNet
+		if ip != nil {
+			ipnet = &net.IPNet{IP: ip}
+		}
+		for _, port := range host.Ports {
+			if port.State.State != "open" {
+				continue
+			}
+			ports := PortList{{First: port.PortID, Last: port.PortID}}
+			emitTargets(ipnet, ports, ScanTarget{Domain: domain, service: port.Service.Name, transport: strings.ToLower(port.Protocol)}, ch)
+		}
+	}
+}
+
+// masscanRecord is a single host record from masscan -oJ or -oD output.
+type masscanRecord struct {
+	IP    string `json:"ip"`
+	Ports []struct {
+		Port    uint16 `json:"port"`
+		Proto   string `json:"proto"`
+		Status  string `json:"status"`
+		Service struct {
+			Name string `json:"name"`
+		} `json:"service"`
+	} `json:"ports"`
+}
+
+// InputTargetsMasscan is an InputTargetsFunc that calls GetTargetsMasscan
+// with the input file provided on the command line.
+func InputTargetsMasscan(ch chan<- ScanTarget) error {
+	return GetTargetsMasscan(config.inputFile, ch)
+}
+
+// GetTargetsMasscan reads masscan JSON output (as written by masscan -oJ, or
+// the newline-delimited -oD variant), and delivers a ScanTarget for every
+// open port to the provided channel. masscan writes one host record per line,
+// wrapped in a JSON array; the array punctuation is ignored, as is the
+// trailing "finished" record written by older versions. Banner records,
+// which carry no port status, are skipped.
+func GetTargetsMasscan(source io.Reader, ch chan<- ScanTarget) error {
+	reader := bufio.NewReader(source)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line = bytes.TrimSpace(line)
+		line = bytes.TrimLeft(line, "[,")
+		line = bytes.TrimRight(line, "],")
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 && !bytes.HasPrefix(line, []byte("{finished")) {
+			var record masscanRecord
+			if perr := json.Unmarshal(line, &record); perr != nil {
+				log.Errorf("parse error, skipping: %v", perr)
+			} else if ip := net.ParseIP(record.IP); ip == nil {
+				log.Errorf("parse error, skipping: can't parse %q as an IP address", record.IP)
+			} else {
+				for _, port := range record.Ports {
+					if port.Status != "open" {
+						continue
+					}
+					ports := PortList{{First: port.Port, Last: port.Port}}
+					emitTargets(&net.IPNet{IP: ip}, ports, ScanTarget{service: port.Service.Name, transport: strings.ToLower(port.Proto)}, ch)
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// InputTargetsZMap is an InputTargetsFunc that calls GetTargetsZMap with the
+// input file provided on the command line.
+func InputTargetsZMap(ch chan<- ScanTarget) error {
+	return GetTargetsZMap(config.inputFile, ch)
+}
+
+// GetTargetsZMap reads ZMap CSV output, and delivers a ScanTarget for every
+// responsive host to the provided channel.
+//
+// If the first line is a header (as written by zmap -O csv), the saddr
+// column gives the address and the sport column, if present, the port.
+// Rows with a success column that is not set, or a repeat column that is
+// set, are skipped. Without a header, each line is a single address, as in
+// ZMap's default output; the port is then left to the command line.
+func GetTargetsZMap(source io.Reader, ch chan<- ScanTarget) error {
+	csvreader := csv.NewReader(source)
+	csvreader.Comment = '#'
+	csvreader.FieldsPerRecord = -1 // variable
+	columns := map[string]int{"saddr": 0}
+	for line := 0; ; line++ {
+		fields, err := csvreader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if line == 0 && len(fields) > 0 && net.ParseIP(strings.TrimSpace(fields[0])) == nil {
+			columns = make(map[string]int, len(fields))
+			for i, name := range fields {
+				columns[strings.TrimSpace(name)] = i
+			}
+			if _, ok := columns["saddr"]; !ok {
+				return fmt.Errorf("zmap input has no saddr column: %q", fields)
+			}
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(fields) {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+		if success := field("success"); success != "" && !zmapTrue(success) {
+			continue
+		}
+		if repeat := field("repeat"); repeat != "" && zmapTrue(repeat) {
+			continue
+		}
+		ip := net.ParseIP(field("saddr"))
+		if ip == nil {
+			log.Errorf("parse error, skipping: can't parse %q as an IP address", field("saddr"))
+			continue
+		}
+		var ports PortList
+		if sport := field("sport"); sport != "" {
+			port, err := strconv.ParseUint(sport, 10, 16)
+			if err != nil {
+				log.Errorf("parse error, skipping: can't parse %q as a port", sport)
+				continue
+			}
+			ports = PortList{{First: uint16(port), Last: uint16(port)}}
+		}
+		emitTargets(&net.IPNet{IP: ip}, ports, ScanTarget{}, ch)
+	}
+}
+
+// zmapTrue interprets a boolean column of ZMap CSV output.
+func zmapTrue(value string) bool {
+	return value == "1" || strings.EqualFold(value, "true")
+}
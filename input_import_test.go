@@ -0,0 +1,177 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// collectTargets runs an input reader over input and returns the String() of
+// each target it generates.
+func collectTargets(t *testing.T, read func(io.Reader, chan<- ScanTarget) error, input string) []string {
+	ch := make(chan ScanTarget, 0)
+	go func() {
+		if err := read(strings.NewReader(input), ch); err != nil {
+			t.Errorf("GetTargets error: %v", err)
+		}
+		close(ch)
+	}()
+	res := []string{}
+	for r := range ch {
+		res = append(res, r.String())
+	}
+	return res
+}
+
+func checkTargets(t *testing.T, got []string, expected []string) {
+	if len(got) != len(expected) {
+		t.Errorf("wrong number of results (got %d %q; expected %d)", len(got), got, len(expected))
+		return
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("wrong ScanTarget %d (got %s; expected %s)", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestGetTargetsNmapXML(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nmaprun>
+<?xml-stylesheet href="file:///usr/bin/../share/nmap/nmap.xsl" type="text/xsl"?>
+<nmaprun scanner="nmap" args="nmap -sV -oX - example.com 10.0.0.2" start="1600000000" version="7.80" xmloutputversion="1.04">
+<host starttime="1600000000" endtime="1600000010"><status state="up" reason="syn-ack" reason_ttl="0"/>
+<address addr="10.0.0.1" addrtype="ipv4"/>
+<address addr="00:11:22:33:44:55" addrtype="mac"/>
+<hostnames>
+<hostname name="example.com" type="user"/>
+<hostname name="host1.example.net" type="PTR"/>
+</hostnames>
+<ports><extraports state="closed" count="997"/>
+<port protocol="tcp" portid="22"><state state="open" reason="syn-ack" reason_ttl="0"/><service name="ssh" product="OpenSSH" version="7.4" method="probed" conf="10"/></port>
+<port protocol="tcp" portid="25"><state state="filtered" reason="no-response" reason_ttl="0"/><service name="smtp" method="table" conf="3"/></port>
+<port protocol="tcp" portid="443"><state state="open" reason="syn-ack" reason_ttl="0"/><service name="http" tunnel="ssl" method="probed" conf="10"/></port>
+</ports>
+</host>
+<host><status state="up"/>
+<address addr="2001:db8::2" addrtype="ipv6"/>
+<ports><port protocol="udp" portid="123"><state state="open" reason="udp-response"/></port></ports>
+</host>
+<runstats><finished time="1600000010"/><hosts up="2" down="0" total="2"/></runstats>
+</nmaprun>
+`
+	checkTargets(t, collectTargets(t, GetTargetsNmapXML, input), []string{
+		"example.com(10.0.0.1) port:22 service:ssh",
+		"example.com(10.0.0.1) port:443 service:http",
+		"2001:db8::2 port:123",
+	})
+}
+
+func TestGetTargetsMasscan(t *testing.T) {
+	input := `[
+{   "ip": "10.0.0.1",   "timestamp": "1600000000", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] }
+,
+{   "ip": "10.0.0.1",   "timestamp": "1600000001", "ports": [ {"port": 80, "proto": "tcp", "service": {"name": "http", "banner": "HTTP/1.1 200 OK"} } ] }
+,
+{   "ip": "10.0.0.2",   "timestamp": "1600000002", "ports": [ {"port": 22, "proto": "tcp", "status": "open", "service": {"name": "ssh"}}, {"port": 23, "proto": "tcp", "status": "closed"} ] }
+,
+{   "ip": "bogus",   "timestamp": "1600000003", "ports": [ {"port": 22, "proto": "tcp", "status": "open"} ] }
+,
+{finished: 1}
+]
+`
+	checkTargets(t, collectTargets(t, GetTargetsMasscan, input), []string{
+		"10.0.0.1 port:80",
+		"10.0.0.2 port:22 service:ssh",
+	})
+}
+
+func TestGetTargetsZMap(t *testing.T) {
+	withHeader := `saddr,daddr,sport,dport,classification,success,repeat
+10.0.0.1,192.0.2.1,443,40000,synack,1,0
+10.0.0.2,192.0.2.1,443,40000,rst,0,0
+10.0.0.1,192.0.2.1,443,40000,synack,1,1
+10.0.0.3,192.0.2.1,8443,40000,synack,1,0
+`
+	checkTargets(t, collectTargets(t, GetTargetsZMap, withHeader), []string{
+		"10.0.0.1 port:443",
+		"10.0.0.3 port:8443",
+	})
+
+	plain := `10.0.0.1
+10.0.0.2
+`
+	checkTargets(t, collectTargets(t, GetTargetsZMap, plain), []string{
+		"10.0.0.1",
+		"10.0.0.2",
+	})
+}
+
+// fakeUDPFlags are the ScanFlags of a fakeScanner of a UDP protocol.
+type fakeUDPFlags struct {
+	BaseFlags
+	UDPFlags
+}
+
+func (f *fakeUDPFlags) Validate(args []string) error { return nil }
+func (f *fakeUDPFlags) Help() string                 { return "" }
+
+func TestImportedTransport(t *testing.T) {
+	input := `<nmaprun><host><address addr="10.0.0.1" addrtype="ipv4"/><ports>
+<port protocol="tcp" portid="53"><state state="open"/></port>
+<port protocol="udp" portid="53"><state state="open"/></port>
+</ports></host></nmaprun>`
+	ch := make(chan ScanTarget, 2)
+	if err := GetTargetsNmapXML(strings.NewReader(input), ch); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	withScanners(nil, []string{"tcp-dns"}, func() {
+		RegisterScanWithFlags("udp-dns", &fakeScanner{name: "udp-dns"}, &fakeUDPFlags{BaseFlags: BaseFlags{Name: "udp-dns"}})
+		var wg sync.WaitGroup
+		mon := MakeMonitor(16, &wg)
+		defer mon.Stop()
+		var got []string
+		for target := range ch {
+			var grab struct {
+				Data map[string]json.RawMessage `json:"data"`
+			}
+			if err := json.Unmarshal(grabTarget(target, mon), &grab); err != nil {
+				t.Fatal(err)
+			}
+			for name := range grab.Data {
+				got = append(got, target.transport+":"+name)
+			}
+		}
+		checkTargets(t, got, []string{"tcp:tcp-dns", "udp:udp-dns"})
+	})
+}
+
+func TestImportedService(t *testing.T) {
+	input := `<nmaprun><host><address addr="10.0.0.1" addrtype="ipv4"/><ports>
+<port protocol="tcp" portid="22"><state state="open"/><service name="ssh"/></port>
+</ports></host></nmaprun>`
+	ch := make(chan ScanTarget, 1)
+	if err := GetTargetsNmapXML(strings.NewReader(input), ch); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	withScanners(nil, []string{"banner"}, func() {
+		RegisterScanWithFlags("ssh", &fakeScanner{name: "ssh", trigger: "ssh"}, &fakeFlags{BaseFlags{Name: "ssh", Trigger: "ssh"}})
+		RegisterScanWithFlags("ftp", &fakeScanner{name: "ftp", trigger: "ftp"}, &fakeFlags{BaseFlags{Name: "ftp", Trigger: "ftp"}})
+		var wg sync.WaitGroup
+		mon := MakeMonitor(16, &wg)
+		defer mon.Stop()
+		var grab struct {
+			Data map[string]json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(grabTarget(<-ch, mon), &grab); err != nil {
+			t.Fatal(err)
+		}
+		if len(grab.Data) != 2 || grab.Data["banner"] == nil || grab.Data["ssh"] == nil {
+			t.Errorf("got responses from %v, expected banner and ssh", grab.Data)
+		}
+	})
+}
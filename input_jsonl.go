@@ -0,0 +1,101 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// jsonTarget is a single record of a JSON-lines input file.
+type jsonTarget struct {
+	IP       string          `json:"ip"`
+	Domain   string          `json:"domain"`
+	Port     json.RawMessage `json:"port"`
+	Tag      string          `json:"tag"`
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+// ParseJSONTarget takes a line from a JSON-lines input file and returns the
+// specified ipnet and ports, along with a template ScanTarget carrying the
+// domain, tag and metadata, or an error.
+//
+// Each line is a JSON object with the optional keys:
+//
+//	ip, domain, port, tag, metadata
+//
+// The ip, domain and tag keys have the same meaning as the corresponding
+// fields of a CSV input file (see ParseCSVTarget), and port may be either a
+// number or a string in any form accepted by ParsePortList. The metadata
+// value is not interpreted; it is copied verbatim into the "metadata" field
+// of every Grab produced for the line.
+func ParseJSONTarget(line []byte) (ipnet *net.IPNet, ports PortList, template ScanTarget, err error) {
+	var record jsonTarget
+	if err = json.Unmarshal(line, &record); err != nil {
+		return
+	}
+	port, err := record.portString()
+	if err != nil {
+		return
+	}
+	ipnet, domain, tag, ports, err := ParseCSVTarget([]string{record.IP, record.Domain, record.Tag, port})
+	if err != nil {
+		return
+	}
+	template = ScanTarget{Domain: domain, Tag: tag}
+	if len(record.Metadata) > 0 && !bytes.Equal(record.Metadata, []byte("null")) {
+		template.Metadata = record.Metadata
+	}
+	return
+}
+
+// portString returns the port field in the textual form used by the PORT
+// field of a CSV input file.
+func (record *jsonTarget) portString() (string, error) {
+	if len(record.Port) == 0 || bytes.Equal(record.Port, []byte("null")) {
+		return "", nil
+	}
+	var number uint16
+	if err := json.Unmarshal(record.Port, &number); err == nil {
+		return strconv.Itoa(int(number)), nil
+	}
+	var list string
+	if err := json.Unmarshal(record.Port, &list); err == nil {
+		return list, nil
+	}
+	return "", fmt.Errorf("can't parse %s as a port", string(record.Port))
+}
+
+// InputTargetsJSONL is an InputTargetsFunc that calls GetTargetsJSONL with
+// the input file provided on the command line.
+func InputTargetsJSONL(ch chan<- ScanTarget) error {
+	return GetTargetsJSONL(config.inputFile, ch)
+}
+
+// GetTargetsJSONL reads targets from a JSON-lines source, generates
+// ScanTargets, and delivers them to the provided channel.
+// Empty lines and lines beginning with # are ignored.
+func GetTargetsJSONL(source io.Reader, ch chan<- ScanTarget) error {
+	reader := bufio.NewReader(source)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && trimmed[0] != '#' {
+			if ipnet, ports, template, perr := ParseJSONTarget(trimmed); perr != nil {
+				log.Errorf("parse error, skipping: %v", perr)
+			} else {
+				emitTargets(ipnet, ports, template, ch)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
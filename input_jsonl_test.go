@@ -0,0 +1,67 @@
+package zgrab2
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestGetTargetsJSONL(t *testing.T) {
+	input := `# Comment
+{"ip": "10.0.0.1", "domain": "example.com", "tag": "tag"}
+
+{"domain": "example.com", "port": 8443, "metadata": {"asset_id": 1234, "owner": ["a", "b"]}}
+{"ip": "10.0.0.2", "port": "80,443", "metadata": null}
+{"ip": "2.2.2.2/31", "metadata": "x"}
+{"ip": "example.com", "domain": "10.0.0.1"}
+not json
+{"ip": "10.0.0.3", "port": true}
+{"ip": "10.0.0.4"}`
+
+	port := func(p uint) *uint {
+		return &p
+	}
+	expected := []ScanTarget{
+		ScanTarget{IP: net.ParseIP("10.0.0.1"), Domain: "example.com", Tag: "tag"},
+		ScanTarget{Domain: "example.com", Port: port(8443), Metadata: []byte(`{"asset_id": 1234, "owner": ["a", "b"]}`)},
+		ScanTarget{IP: net.ParseIP("10.0.0.2"), Port: port(80)},
+		ScanTarget{IP: net.ParseIP("10.0.0.2"), Port: port(443)},
+		ScanTarget{IP: net.ParseIP("2.2.2.2"), Metadata: []byte(`"x"`)},
+		ScanTarget{IP: net.ParseIP("2.2.2.3"), Metadata: []byte(`"x"`)},
+		ScanTarget{IP: net.ParseIP("10.0.0.4")},
+	}
+
+	ch := make(chan ScanTarget, 0)
+	go func() {
+		err := GetTargetsJSONL(strings.NewReader(input), ch)
+		if err != nil {
+			t.Errorf("GetTargets error: %v", err)
+		}
+		close(ch)
+	}()
+	res := []ScanTarget{}
+	for r := range ch {
+		res = append(res, r)
+	}
+
+	if len(res) != len(expected) {
+		t.Errorf("wrong number of results (got %d; expected %d)", len(res), len(expected))
+		return
+	}
+	for i := range expected {
+		if res[i].String() != expected[i].String() || string(res[i].Metadata) != string(expected[i].Metadata) {
+			t.Errorf("wrong data in ScanTarget %d (got %v %s; expected %v %s)", i, res[i], res[i].Metadata, expected[i], expected[i].Metadata)
+		}
+	}
+}
+
+func TestEncodeGrabMetadata(t *testing.T) {
+	target := ScanTarget{IP: net.ParseIP("10.0.0.1"), Metadata: []byte(`{"asset_id":1234}`)}
+	encoded, err := EncodeGrab(BuildGrabFromInputResponse(&target, nil), false)
+	if err != nil {
+		t.Fatalf("EncodeGrab error: %v", err)
+	}
+	if expected := `{"ip":"10.0.0.1","metadata":{"asset_id":1234}}`; string(encoded) != expected {
+		t.Errorf("wrong encoding (got %s; expected %s)", encoded, expected)
+	}
+}
@@ -1,6 +1,7 @@
 package zgrab2
 
 import (
+	"fmt"
 	"net"
 	"strings"
 	"testing"
@@ -39,6 +40,7 @@ func TestParseCSVTarget(t *testing.T) {
 		ipnet   *net.IPNet
 		domain  string
 		tag     string
+		ports   string
 		success bool
 	}{
 		// IP DOMAIN TAG
@@ -101,6 +103,18 @@ func TestParseCSVTarget(t *testing.T) {
 			domain:  "example.com",
 			success: true,
 		},
+		// Bare DOMAIN:PORT
+		{
+			fields:  []string{"example.com:443"},
+			domain:  "example.com",
+			ports:   "443",
+			success: true,
+		},
+		// Error: Bare domain with a bad port
+		{
+			fields:  []string{"example.com:http"},
+			success: false,
+		},
 		// Error: Empty record (1 field)
 		{
 			fields:  []string{""},
@@ -116,11 +130,82 @@ func TestParseCSVTarget(t *testing.T) {
 			fields:  []string{"", "", "tag"},
 			success: false,
 		},
-		// Error: Too many fields
+		// IP DOMAIN TAG PORT
+		{
+			fields:  []string{"10.0.0.1", "example.com", "tag", "443"},
+			ipnet:   parseIP("10.0.0.1"),
+			domain:  "example.com",
+			tag:     "tag",
+			ports:   "443",
+			success: true,
+		},
+		// CIDR with port list
+		{
+			fields:  []string{"10.0.0.1/8", "", "", "80,443,8000-8100"},
+			ipnet:   parseCIDR("10.0.0.1/8"),
+			ports:   "80,443,8000-8100",
+			success: true,
+		},
+		// IP:PORT
+		{
+			fields:  []string{"10.0.0.1:8080"},
+			ipnet:   parseIP("10.0.0.1"),
+			ports:   "8080",
+			success: true,
+		},
+		// IP:PORTS DOMAIN
+		{
+			fields:  []string{"10.0.0.1:80,443,8000-8100", "example.com"},
+			ipnet:   parseIP("10.0.0.1"),
+			domain:  "example.com",
+			ports:   "80,443,8000-8100",
+			success: true,
+		},
+		// CIDR:PORT
+		{
+			fields:  []string{"10.0.0.1/8:22"},
+			ipnet:   parseCIDR("10.0.0.1/8"),
+			ports:   "22",
+			success: true,
+		},
+		// [IPv6]:PORT
+		{
+			fields:  []string{"[2001:db8::1]:443"},
+			ipnet:   parseIP("2001:db8::1"),
+			ports:   "443",
+			success: true,
+		},
+		// Bare IPv6
+		{
+			fields:  []string{"2001:db8::1"},
+			ipnet:   parseIP("2001:db8::1"),
+			success: true,
+		},
+		// Error: No address or domain
 		{
 			fields:  []string{"", "", "", ""},
 			success: false,
 		},
+		// Error: Too many fields
+		{
+			fields:  []string{"10.0.0.1", "", "", "", ""},
+			success: false,
+		},
+		// Error: Ports in both IP and PORT fields
+		{
+			fields:  []string{"10.0.0.1:80", "", "", "443"},
+			success: false,
+		},
+		// Error: Bad port
+		{
+			fields:  []string{"10.0.0.1", "", "", "65536"},
+			success: false,
+		},
+		// Error: Reversed port range
+		{
+			fields:  []string{"10.0.0.1:100-90", ""},
+			success: false,
+		},
 		// Error: IP and domain reversed
 		{
 			fields:  []string{"example.com", "10.0.0.1"},
@@ -129,14 +214,14 @@ func TestParseCSVTarget(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		ipnet, domain, tag, err := ParseCSVTarget(test.fields)
+		ipnet, domain, tag, ports, err := ParseCSVTarget(test.fields)
 		if (err == nil) != test.success {
 			t.Errorf("wrong error status (got err=%v, success should be %v): %q", err, test.success, test.fields)
 			return
 		}
 		if err == nil {
-			if ipnetString(ipnet) != ipnetString(test.ipnet) || domain != test.domain || tag != test.tag {
-				t.Errorf("wrong result (got %v,%v,%v; expected %v,%v,%v): %q", ipnetString(ipnet), domain, tag, ipnetString(test.ipnet), test.domain, test.tag, test.fields)
+			if ipnetString(ipnet) != ipnetString(test.ipnet) || domain != test.domain || tag != test.tag || ports.String() != test.ports {
+				t.Errorf("wrong result (got %v,%v,%v,%v; expected %v,%v,%v,%v): %q", ipnetString(ipnet), domain, tag, ports, ipnetString(test.ipnet), test.domain, test.tag, test.ports, test.fields)
 				return
 			}
 		}
@@ -144,13 +229,26 @@ func TestParseCSVTarget(t *testing.T) {
 }
 
 func TestGetTargetsCSV(t *testing.T) {
+	port := func(p uint) *uint {
+		return &p
+	}
+	portString := func(p *uint) string {
+		if p == nil {
+			return "<nil>"
+		}
+		return fmt.Sprintf("%d", *p)
+	}
+
 	input := `# Comment
 10.0.0.1,example.com,tag
  10.0.0.1 ,"example.com"
 10.0.0.1
 ,example.com
 example.com
-2.2.2.2/30,, tag`
+2.2.2.2/30,, tag
+3.3.3.3:22
+"3.3.3.4:80,443",example.com
+3.3.3.4/31,,,8000-8001`
 
 	expected := []ScanTarget{
 		ScanTarget{IP: net.ParseIP("10.0.0.1"), Domain: "example.com", Tag: "tag"},
@@ -162,6 +260,13 @@ example.com
 		ScanTarget{IP: net.ParseIP("2.2.2.1"), Tag: "tag"},
 		ScanTarget{IP: net.ParseIP("2.2.2.2"), Tag: "tag"},
 		ScanTarget{IP: net.ParseIP("2.2.2.3"), Tag: "tag"},
+		ScanTarget{IP: net.ParseIP("3.3.3.3"), Port: port(22)},
+		ScanTarget{IP: net.ParseIP("3.3.3.4"), Domain: "example.com", Port: port(80)},
+		ScanTarget{IP: net.ParseIP("3.3.3.4"), Domain: "example.com", Port: port(443)},
+		ScanTarget{IP: net.ParseIP("3.3.3.4"), Port: port(8000)},
+		ScanTarget{IP: net.ParseIP("3.3.3.4"), Port: port(8001)},
+		ScanTarget{IP: net.ParseIP("3.3.3.5"), Port: port(8000)},
+		ScanTarget{IP: net.ParseIP("3.3.3.5"), Port: port(8001)},
 	}
 
 	ch := make(chan ScanTarget, 0)
@@ -184,8 +289,48 @@ example.com
 	for i := range expected {
 		if res[i].IP.String() != expected[i].IP.String() ||
 			res[i].Domain != expected[i].Domain ||
-			res[i].Tag != expected[i].Tag {
+			res[i].Tag != expected[i].Tag ||
+			portString(res[i].Port) != portString(expected[i].Port) {
 			t.Errorf("wrong data in ScanTarget %d (got %v; expected %v)", i, res[i], expected[i])
 		}
 	}
 }
+
+func TestParsePortList(t *testing.T) {
+	tests := []struct {
+		in      string
+		ports   []uint
+		success bool
+	}{
+		{in: "80", ports: []uint{80}, success: true},
+		{in: "80,443", ports: []uint{80, 443}, success: true},
+		{in: "8000-8002, 22", ports: []uint{8000, 8001, 8002, 22}, success: true},
+		{in: "1-1", ports: []uint{1}, success: true},
+		{in: "65535", ports: []uint{65535}, success: true},
+		{in: "0", success: false},
+		{in: "0-10", success: false},
+		{in: "0-0", success: false},
+		{in: "", success: false},
+		{in: "80,", success: false},
+		{in: "http", success: false},
+		{in: "65536", success: false},
+		{in: "10-1", success: false},
+		{in: "1-2-3", success: false},
+	}
+	for _, test := range tests {
+		ports, err := ParsePortList(test.in)
+		if (err == nil) != test.success {
+			t.Errorf("wrong error status (got err=%v, success should be %v): %q", err, test.success, test.in)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got := fmt.Sprint(ports.Ports()); got != fmt.Sprint(test.ports) {
+			t.Errorf("wrong ports for %q (got %s; expected %v)", test.in, got, test.ports)
+		}
+		if ports.Len() != len(test.ports) {
+			t.Errorf("wrong length for %q (got %d; expected %d)", test.in, ports.Len(), len(test.ports))
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package zgrab2
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LatencyStats summarizes a set of durations, in seconds.
+type LatencyStats struct {
+	Count uint64  `json:"count"`
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+func (l *LatencyStats) add(d time.Duration) {
+	s := d.Seconds()
+	if l.Count == 0 || s < l.Min {
+		l.Min = s
+	}
+	if s > l.Max {
+		l.Max = s
+	}
+	l.Mean += (s - l.Mean) / float64(l.Count+1)
+	l.Count++
+}
+
+// ScanMetrics break down the scans of a module that ended with a given
+// status.
+type ScanMetrics struct {
+	Scans uint64 `json:"scans"`
+
+	// Duration is the time taken by each scan, including retries.
+	Duration LatencyStats `json:"duration"`
+
+	// Connect is the time taken to establish each connection, and FirstByte
+	// the time from then until the first byte was read.
+	Connect   LatencyStats `json:"connect"`
+	FirstByte LatencyStats `json:"first_byte"`
+
+	BytesRead    uint64 `json:"bytes_read"`
+	BytesWritten uint64 `json:"bytes_written"`
+}
+
+// record adds a scan to the metrics.
+func (m *ScanMetrics) record(duration time.Duration, conns []connectionStats) {
+	m.Scans++
+	m.Duration.add(duration)
+	for _, c := range conns {
+		m.Connect.add(c.connect)
+		if c.firstByte > 0 {
+			m.FirstByte.add(c.firstByte)
+		}
+		m.BytesRead += c.bytesRead
+		m.BytesWritten += c.bytesWritten
+	}
+}
+
+// The Prometheus metrics, served with --prometheus.
+var (
+	scansTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "zgrab2_scans_total",
+		Help: "Number of scans, by module and status.",
+	}, []string{"module", "status"})
+	scanDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "zgrab2_scan_duration_seconds",
+		Help:    "Time taken by each scan, including retries, by module and status.",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"module", "status"})
+	connectDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "zgrab2_connect_duration_seconds",
+		Help:    "Time taken to establish each connection, by module and status of the scan.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"module", "status"})
+	firstByteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "zgrab2_first_byte_seconds",
+		Help:    "Time from establishing each connection to reading its first byte, by module and status of the scan.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"module", "status"})
+	bytesRead = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "zgrab2_bytes_read_total",
+		Help: "Bytes read from the targets, by module and status of the scan.",
+	}, []string{"module", "status"})
+	bytesWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "zgrab2_bytes_written_total",
+		Help: "Bytes written to the targets, by module and status of the scan.",
+	}, []string{"module", "status"})
+	scansInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "zgrab2_scans_in_flight",
+		Help: "Number of scans running, by module.",
+	}, []string{"module"})
+	queues = &queueCollector{
+		desc: prometheus.NewDesc("zgrab2_queue_depth", "Number of items waiting in each queue of the scan.", []string{"queue"}, nil),
+	}
+)
+
+func init() {
+	prometheus.MustRegister(scansTotal, scanDuration, connectDuration, firstByteDuration, bytesRead, bytesWritten, scansInFlight, queues)
+}
+
+// observe adds a scan to the Prometheus metrics.
+func observe(module string, status ScanStatus, duration time.Duration, conns []connectionStats) {
+	labels := prometheus.Labels{"module": module, "status": string(status)}
+	scansTotal.With(labels).Inc()
+	scanDuration.With(labels).Observe(duration.Seconds())
+	for _, c := range conns {
+		connectDuration.With(labels).Observe(c.connect.Seconds())
+		if c.firstByte > 0 {
+			firstByteDuration.With(labels).Observe(c.firstByte.Seconds())
+		}
+		bytesRead.With(labels).Add(float64(c.bytesRead))
+		bytesWritten.With(labels).Add(float64(c.bytesWritten))
+	}
+}
+
+// queueCollector reports the lengths of the queues of the running scan
+// when scraped.
+type queueCollector struct {
+	desc   *prometheus.Desc
+	mutex  sync.Mutex
+	queues map[string]func() int
+}
+
+// set replaces the queues reported.
+func (c *queueCollector) set(queues map[string]func() int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.queues = queues
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for name, length := range c.queues {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(length()), name)
+	}
+}
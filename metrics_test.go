@@ -0,0 +1,93 @@
+package zgrab2
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLatencyStats(t *testing.T) {
+	tests := []struct {
+		durations []time.Duration
+		expected  LatencyStats
+	}{
+		{nil, LatencyStats{}},
+		{[]time.Duration{time.Second}, LatencyStats{Count: 1, Mean: 1, Min: 1, Max: 1}},
+		{[]time.Duration{2 * time.Second, 500 * time.Millisecond, time.Second / 2}, LatencyStats{Count: 3, Mean: 1, Min: 0.5, Max: 2}},
+	}
+	for i, test := range tests {
+		var stats LatencyStats
+		for _, d := range test.durations {
+			stats.add(d)
+		}
+		if stats != test.expected {
+			t.Errorf("%d: got %+v, expected %+v", i, stats, test.expected)
+		}
+	}
+}
+
+// echoScanner writes a greeting to the target and reads it back.
+type echoScanner struct {
+	fakeScanner
+	flags *BaseFlags
+}
+
+func (s *echoScanner) Scan(t ScanTarget) (ScanStatus, interface{}, error) {
+	conn, err := t.Open(s.flags)
+	if err != nil {
+		return TryGetScanStatus(err), nil, err
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+	_, err = io.ReadFull(conn, make([]byte, 5))
+	if err != nil {
+		return TryGetScanStatus(err), nil, err
+	}
+	return SCAN_SUCCESS, nil, nil
+}
+
+func TestMonitorMetrics(t *testing.T) {
+	echo, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	port := uint(echo.Addr().(*net.TCPAddr).Port)
+
+	var wg sync.WaitGroup
+	mon := MakeMonitor(16, &wg)
+	s := &echoScanner{fakeScanner: fakeScanner{name: "echo"}, flags: &BaseFlags{Port: port, Timeout: time.Second}}
+	target := ScanTarget{IP: net.ParseIP("127.0.0.1")}
+	for i := 0; i < 2; i++ {
+		runScanner(s, s.flags, mon, target)
+	}
+	runScanner(&flakyScanner{fakeScanner: fakeScanner{name: "echo"}, statuses: []ScanStatus{SCAN_IO_TIMEOUT}}, nil, mon, target)
+	mon.Stop()
+	wg.Wait()
+
+	metrics := mon.GetMetrics()["echo"]
+	success := metrics[SCAN_SUCCESS]
+	if success == nil || success.Scans != 2 || success.Connect.Count != 2 || success.FirstByte.Count != 2 {
+		t.Fatalf("wrong metrics for the successful scans: %+v", success)
+	}
+	if success.BytesRead != 10 || success.BytesWritten != 10 {
+		t.Errorf("got %d bytes read and %d written, expected 10 and 10", success.BytesRead, success.BytesWritten)
+	}
+	if failure := metrics[SCAN_IO_TIMEOUT]; failure == nil || failure.Scans != 1 || failure.Connect.Count != 0 {
+		t.Errorf("wrong metrics for the failed scan: %+v", failure)
+	}
+	if states := mon.GetStatuses()["echo"]; states.Successes != 2 || states.Failures != 1 {
+		t.Errorf("wrong statuses: %+v", states)
+	}
+}
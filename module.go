@@ -36,6 +36,28 @@ type ScanResponse struct {
 	Result    interface{} `json:"result,omitempty"`
 	Timestamp string      `json:"timestamp,omitempty"`
 	Error     *string     `json:"error,omitempty"`
+
+	// ErrorType names the cause of the error more precisely than the
+	// status, when it is recognized (see TryGetErrorType).
+	ErrorType string `json:"error_type,omitempty"`
+
+	// Service is the identity of the service, for modules that implement
+	// ServiceIdentifier.
+	Service *ServiceInfo `json:"service,omitempty"`
+
+	// SourceIP is the local address the target was scanned from, with
+	// --source-ip.
+	SourceIP string `json:"source_ip,omitempty"`
+
+	// Connection describes the connections made by the last try of the
+	// scan, with --connection-info.
+	Connection *ConnectionInfo `json:"connection,omitempty"`
+
+	// Attempts is the number of times the scan was tried, with --retries.
+	Attempts int `json:"attempts,omitempty"`
+
+	// AttemptErrors are the errors of the tries before the last, in order.
+	AttemptErrors []string `json:"attempt_errors,omitempty"`
 }
 
 // ScanModule is an interface which represents a module that the framework can
@@ -70,8 +92,70 @@ type BaseFlags struct {
 	Port           uint          `short:"p" long:"port" description:"Specify port to grab on"`
 	Name           string        `short:"n" long:"name" description:"Specify name for output json, only necessary if scanning multiple modules"`
 	Timeout        time.Duration `short:"t" long:"timeout" description:"Set connection timeout (0 = no timeout)" default:"10s"`
+	ConnectTimeout time.Duration `long:"connect-timeout" description:"Set the timeout for establishing a connection (0 = --timeout)"`
+	ReadTimeout    time.Duration `long:"read-timeout" description:"Set the timeout for each read (0 = --timeout)"`
+	WriteTimeout   time.Duration `long:"write-timeout" description:"Set the timeout for each write (0 = --timeout)"`
+	SessionTimeout time.Duration `long:"session-timeout" description:"Set the timeout for the whole connection, after which all reads and writes fail (0 = --timeout, or longer if the other timeouts need it)"`
 	Trigger        string        `short:"g" long:"trigger" description:"Invoke only on targets with specified tag"`
 	BytesReadLimit int           `short:"m" long:"maxbytes" description:"Maximum byte read limit per scan (0 = defaults)"`
+
+	Retries         int           `long:"retries" default:"0" description:"Number of times to retry a scan that ends with one of the --retry-on statuses"`
+	RetryOn         string        `long:"retry-on" default:"connection-timeout,io-timeout" description:"Comma-separated statuses to retry a scan on"`
+	RetryBackoff    time.Duration `long:"retry-backoff" default:"1s" description:"Delay before the first retry, doubled for each further retry, with random jitter"`
+	RetryMaxBackoff time.Duration `long:"retry-max-backoff" default:"30s" description:"Maximum delay between retries (0 = no limit)"`
+
+	retryOn map[ScanStatus]bool
+}
+
+// orTimeout returns t, or the --timeout if t is zero.
+func (b *BaseFlags) orTimeout(t time.Duration) time.Duration {
+	if t == 0 {
+		return b.Timeout
+	}
+	return t
+}
+
+// GetConnectTimeout returns the timeout for establishing a connection.
+func (b *BaseFlags) GetConnectTimeout() time.Duration {
+	return b.orTimeout(b.ConnectTimeout)
+}
+
+// GetReadTimeout returns the timeout for each read.
+func (b *BaseFlags) GetReadTimeout() time.Duration {
+	return b.orTimeout(b.ReadTimeout)
+}
+
+// GetWriteTimeout returns the timeout for each write.
+func (b *BaseFlags) GetWriteTimeout() time.Duration {
+	return b.orTimeout(b.WriteTimeout)
+}
+
+// GetSessionTimeout returns the timeout for the whole connection. Unless
+// set, it is the --timeout, extended if need be to leave room for a
+// connect and then a read or write, when their timeouts are set.
+func (b *BaseFlags) GetSessionTimeout() time.Duration {
+	if b.SessionTimeout != 0 || b.Timeout == 0 || (b.ConnectTimeout == 0 && b.ReadTimeout == 0 && b.WriteTimeout == 0) {
+		return b.orTimeout(b.SessionTimeout)
+	}
+	longest := b.GetReadTimeout()
+	if write := b.GetWriteTimeout(); write > longest {
+		longest = write
+	}
+	if needed := b.GetConnectTimeout() + longest; needed > b.Timeout {
+		return needed
+	}
+	return b.Timeout
+}
+
+// NewDialer returns a Dialer using the timeouts and read limit of the flags.
+func (b *BaseFlags) NewDialer() *Dialer {
+	return NewDialer(&Dialer{
+		Timeout:        b.GetSessionTimeout(),
+		ConnectTimeout: b.GetConnectTimeout(),
+		ReadTimeout:    b.GetReadTimeout(),
+		WriteTimeout:   b.GetWriteTimeout(),
+		BytesReadLimit: b.BytesReadLimit,
+	})
 }
 
 // UDPFlags contains the common options used for all UDP scans
@@ -85,6 +169,16 @@ func (b *BaseFlags) GetName() string {
 	return b.Name
 }
 
+// GetBaseFlags returns the BaseFlags embedded in a module's flags.
+func (b *BaseFlags) GetBaseFlags() *BaseFlags {
+	return b
+}
+
+// GetUDPFlags returns the UDPFlags embedded in a module's flags.
+func (u *UDPFlags) GetUDPFlags() *UDPFlags {
+	return u
+}
+
 // GetModule returns the registered module that corresponds to the given name
 // or nil otherwise
 func GetModule(name string) ScanModule {
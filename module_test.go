@@ -0,0 +1,44 @@
+package zgrab2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBaseFlagsTimeouts(t *testing.T) {
+	tests := []struct {
+		flags                         BaseFlags
+		connect, read, write, session time.Duration
+	}{
+		{
+			flags:   BaseFlags{Timeout: 10 * time.Second},
+			connect: 10 * time.Second, read: 10 * time.Second, write: 10 * time.Second, session: 10 * time.Second,
+		},
+		{
+			flags:   BaseFlags{Timeout: 10 * time.Second, ConnectTimeout: time.Second, ReadTimeout: 30 * time.Second, SessionTimeout: time.Minute},
+			connect: time.Second, read: 30 * time.Second, write: 10 * time.Second, session: time.Minute,
+		},
+		{
+			flags:   BaseFlags{Timeout: 10 * time.Second, ConnectTimeout: time.Second, ReadTimeout: 30 * time.Second},
+			connect: time.Second, read: 30 * time.Second, write: 10 * time.Second, session: 31 * time.Second,
+		},
+		{
+			flags:   BaseFlags{Timeout: 10 * time.Second, ConnectTimeout: 20 * time.Second},
+			connect: 20 * time.Second, read: 10 * time.Second, write: 10 * time.Second, session: 30 * time.Second,
+		},
+		{
+			flags:   BaseFlags{WriteTimeout: 5 * time.Second},
+			connect: 0, read: 0, write: 5 * time.Second, session: 0,
+		},
+	}
+	for i, test := range tests {
+		f := test.flags
+		if f.GetConnectTimeout() != test.connect || f.GetReadTimeout() != test.read || f.GetWriteTimeout() != test.write || f.GetSessionTimeout() != test.session {
+			t.Errorf("%d: wrong timeouts %s, %s, %s, %s", i, f.GetConnectTimeout(), f.GetReadTimeout(), f.GetWriteTimeout(), f.GetSessionTimeout())
+		}
+		d := f.NewDialer()
+		if d.ConnectTimeout != test.connect || d.ReadTimeout != test.read || d.WriteTimeout != test.write {
+			t.Errorf("%d: wrong dialer timeouts %+v", i, d)
+		}
+	}
+}
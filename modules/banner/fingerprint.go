@@ -0,0 +1,185 @@
+package banner
+
+import (
+	"encoding/binary"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ServiceMatch is the service identified by a match directive, with the
+// version templates expanded.
+type ServiceMatch struct {
+	// Probe is the name of the probe whose response matched.
+	Probe string `json:"probe"`
+
+	// Service is the service name given by the match, e.g. "ssh".
+	Service string `json:"service"`
+
+	// SoftMatch is true if the match was a softmatch, which identifies the
+	// service but not the product.
+	SoftMatch bool `json:"softmatch,omitempty"`
+
+	Product    string   `json:"product,omitempty"`
+	Version    string   `json:"version,omitempty"`
+	Info       string   `json:"info,omitempty"`
+	Hostname   string   `json:"hostname,omitempty"`
+	OS         string   `json:"os,omitempty"`
+	DeviceType string   `json:"device_type,omitempty"`
+	CPE        []string `json:"cpe,omitempty"`
+}
+
+// SelectProbes returns the probes to send to the given port, in the order
+// they should be sent. For TCP the NULL probe (which sends nothing and waits
+// for a banner) comes first, followed by the probes that list the port in
+// their ports directive, then the remaining probes with a rarity no greater
+// than intensity. No probes are returned for excluded ports.
+func (p *ServiceProbes) SelectProbes(protocol string, port uint, intensity int) []*ServiceProbe {
+	excluded := p.ExcludeTCP
+	if protocol == "udp" {
+		excluded = p.ExcludeUDP
+	}
+	if containsPort(excluded, port) {
+		return nil
+	}
+	var null, listed, rest []*ServiceProbe
+	for _, probe := range p.Probes {
+		switch {
+		case probe.Protocol != protocol:
+			continue
+		case protocol == "tcp" && len(probe.Payload) == 0:
+			null = append(null, probe)
+		case containsPort(probe.Ports, port) || containsPort(probe.SSLPorts, port):
+			listed = append(listed, probe)
+		case probe.Rarity <= intensity:
+			rest = append(rest, probe)
+		}
+	}
+	return append(append(null, listed...), rest...)
+}
+
+// MatchResponse matches the response to probe against the probe's match
+// directives, then those of its fallback probes, and, for TCP probes, those
+// of the NULL probe. The first hard match is returned; if there is none, the
+// first softmatch is returned; otherwise nil.
+func (p *ServiceProbes) MatchResponse(probe *ServiceProbe, response []byte) *ServiceMatch {
+	candidates := []*ServiceProbe{probe}
+	for _, name := range probe.Fallback {
+		candidates = append(candidates, p.byName[name])
+	}
+	if probe.Protocol == "tcp" && len(probe.Payload) > 0 {
+		for _, other := range p.Probes {
+			if other.Protocol == "tcp" && len(other.Payload) == 0 {
+				candidates = append(candidates, other)
+			}
+		}
+	}
+	text := latin1(response)
+	var soft *ServiceMatch
+	for _, candidate := range candidates {
+		for _, matcher := range candidate.Matches {
+			if matcher.Soft && soft != nil {
+				continue
+			}
+			groups := matcher.Pattern.FindStringSubmatch(text)
+			if groups == nil {
+				continue
+			}
+			match := matcher.expand(groups)
+			match.Probe = probe.Name
+			if !matcher.Soft {
+				return match
+			}
+			soft = match
+		}
+	}
+	return soft
+}
+
+// expand fills in the version templates of the matcher with the submatches
+// of its pattern.
+func (m *ServiceMatcher) expand(groups []string) *ServiceMatch {
+	ret := &ServiceMatch{
+		Service:    m.Service,
+		SoftMatch:  m.Soft,
+		Product:    expandTemplate(m.Product, groups),
+		Version:    expandTemplate(m.Version, groups),
+		Info:       expandTemplate(m.Info, groups),
+		Hostname:   expandTemplate(m.Hostname, groups),
+		OS:         expandTemplate(m.OS, groups),
+		DeviceType: expandTemplate(m.DeviceType, groups),
+	}
+	for _, cpe := range m.CPE {
+		ret.CPE = append(ret.CPE, expandTemplate(cpe, groups))
+	}
+	return ret
+}
+
+// templateFunction matches the helper functions allowed in version
+// templates: $P(n), $SUBST(n,"from","to") and $I(n,"<") or $I(n,">").
+var templateFunction = regexp.MustCompile(`^\$(P|SUBST|I)\((\d)((?:,"[^"]*")*)\)`)
+
+// expandTemplate substitutes the submatches of a pattern into a version
+// template. $1 through $9 are replaced with the corresponding submatch;
+// $P(n) with the printable characters of submatch n; $SUBST(n,"a","b") with
+// submatch n, replacing each "a" with "b"; and $I(n,">") with submatch n
+// decoded as a big- (">") or little- ("<") endian unsigned integer.
+func expandTemplate(template string, groups []string) string {
+	if !strings.Contains(template, "$") {
+		return template
+	}
+	group := func(n int) []byte {
+		if n < len(groups) {
+			return unlatin1(groups[n])
+		}
+		return nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(template); i++ {
+		if template[i] != '$' || i+1 == len(template) {
+			b.WriteByte(template[i])
+			continue
+		}
+		if c := template[i+1]; c >= '0' && c <= '9' {
+			b.Write(group(int(c - '0')))
+			i++
+			continue
+		}
+		m := templateFunction.FindStringSubmatch(template[i:])
+		if m == nil {
+			b.WriteByte(template[i])
+			continue
+		}
+		n, _ := strconv.Atoi(m[2])
+		var args []string
+		for _, arg := range strings.Split(m[3], ",")[1:] {
+			args = append(args, strings.Trim(arg, `"`))
+		}
+		value := group(n)
+		switch m[1] {
+		case "P":
+			for _, c := range value {
+				if c >= 0x20 && c < 0x7f {
+					b.WriteByte(c)
+				}
+			}
+		case "SUBST":
+			if len(args) == 2 {
+				b.WriteString(strings.Replace(string(value), args[0], args[1], -1))
+			}
+		case "I":
+			if len(args) == 1 && len(value) > 0 && len(value) <= 8 {
+				buf := make([]byte, 8)
+				if args[0] == ">" {
+					copy(buf[8-len(value):], value)
+					b.WriteString(strconv.FormatUint(binary.BigEndian.Uint64(buf), 10))
+				} else {
+					copy(buf, value)
+					b.WriteString(strconv.FormatUint(binary.LittleEndian.Uint64(buf), 10))
+				}
+			}
+		}
+		i += len(m[0]) - 1
+	}
+	return b.String()
+}
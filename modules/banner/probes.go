@@ -0,0 +1,370 @@
+package banner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zgrab2"
+)
+
+// This file parses service probe databases in the nmap-service-probes format
+// (see https://nmap.org/book/vscan-fileformat.html). The patterns in these
+// files are PCRE; the few that use features RE2 lacks (e.g. backreferences or
+// lookaround) cannot be compiled by Go and are skipped.
+
+// ServiceProbes is a parsed service probe database.
+type ServiceProbes struct {
+	// Probes lists the probes in the order in which they appear in the file.
+	Probes []*ServiceProbe
+
+	// ExcludeTCP and ExcludeUDP are the ports the Exclude directive says must
+	// not be probed.
+	ExcludeTCP zgrab2.PortList
+	ExcludeUDP zgrab2.PortList
+
+	// Skipped is the number of match directives whose pattern could not be
+	// compiled.
+	Skipped int
+
+	byName map[string]*ServiceProbe
+}
+
+// ServiceProbe is a single Probe directive, along with the directives that
+// follow it.
+type ServiceProbe struct {
+	Protocol    string
+	Name        string
+	Payload     []byte
+	Ports       zgrab2.PortList
+	SSLPorts    zgrab2.PortList
+	Rarity      int
+	TotalWaitMS int
+	Fallback    []string
+	Matches     []*ServiceMatcher
+}
+
+// ServiceMatcher is a single match or softmatch directive.
+type ServiceMatcher struct {
+	Service string
+	Soft    bool
+	Pattern *regexp.Regexp
+
+	// Version templates, which may refer to the submatches of Pattern.
+	Product    string
+	Version    string
+	Info       string
+	Hostname   string
+	OS         string
+	DeviceType string
+	CPE        []string
+}
+
+// defaultRarity and defaultTotalWaitMS are used for probes that do not give
+// a rarity or totalwaitms directive.
+const (
+	defaultRarity      = 5
+	defaultTotalWaitMS = 5000
+)
+
+// LoadServiceProbes reads a service probe database from the named file.
+func LoadServiceProbes(path string) (*ServiceProbes, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseServiceProbes(f)
+}
+
+// ParseServiceProbes reads a service probe database in the nmap-service-probes
+// format.
+func ParseServiceProbes(source io.Reader) (*ServiceProbes, error) {
+	ret := &ServiceProbes{byName: make(map[string]*ServiceProbe)}
+	var probe *ServiceProbe
+	scanner := bufio.NewScanner(source)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		directive, rest := splitDirective(line)
+		if directive != "Probe" && directive != "Exclude" && probe == nil {
+			return nil, fmt.Errorf("line %d: %s before first Probe", lineNumber, directive)
+		}
+		var err error
+		switch directive {
+		case "Exclude":
+			ret.ExcludeTCP, ret.ExcludeUDP, err = parseExclude(rest)
+		case "Probe":
+			if probe, err = parseProbe(rest); err == nil {
+				ret.Probes = append(ret.Probes, probe)
+				ret.byName[probe.Name] = probe
+			}
+		case "match", "softmatch":
+			var matcher *ServiceMatcher
+			if matcher, err = parseMatch(rest, directive == "softmatch"); err == nil {
+				probe.Matches = append(probe.Matches, matcher)
+			} else if _, ok := err.(*patternError); ok {
+				log.Debugf("skipping service probe pattern on line %d: %v", lineNumber, err)
+				ret.Skipped++
+				err = nil
+			}
+		case "ports":
+			probe.Ports, err = zgrab2.ParsePortList(rest)
+		case "sslports":
+			probe.SSLPorts, err = zgrab2.ParsePortList(rest)
+		case "rarity":
+			probe.Rarity, err = strconv.Atoi(rest)
+		case "totalwaitms":
+			probe.TotalWaitMS, err = strconv.Atoi(rest)
+		case "tcpwrappedms":
+			_, err = strconv.Atoi(rest)
+		case "fallback":
+			for _, name := range strings.Split(rest, ",") {
+				probe.Fallback = append(probe.Fallback, strings.TrimSpace(name))
+			}
+		default:
+			log.Debugf("skipping unknown service probe directive %q on line %d", directive, lineNumber)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, probe := range ret.Probes {
+		for _, name := range probe.Fallback {
+			if ret.byName[name] == nil {
+				return nil, fmt.Errorf("probe %s: unknown fallback probe %s", probe.Name, name)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func splitDirective(line string) (directive string, rest string) {
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		return line[:i], strings.TrimSpace(line[i+1:])
+	}
+	return line, ""
+}
+
+// parseExclude parses the port list of an Exclude directive, e.g.
+// "T:9100-9107,U:30000-40000,1234". A T: or U: prefix applies to the entries
+// that follow it; entries before any prefix apply to both protocols.
+func parseExclude(spec string) (tcp zgrab2.PortList, udp zgrab2.PortList, err error) {
+	protocol := ""
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if strings.HasPrefix(item, "T:") || strings.HasPrefix(item, "U:") {
+			protocol, item = item[:1], item[2:]
+		}
+		var ports zgrab2.PortList
+		if ports, err = zgrab2.ParsePortList(item); err != nil {
+			return nil, nil, err
+		}
+		if protocol != "U" {
+			tcp = append(tcp, ports...)
+		}
+		if protocol != "T" {
+			udp = append(udp, ports...)
+		}
+	}
+	return tcp, udp, nil
+}
+
+// parseProbe parses the arguments of a Probe directive, e.g.
+// "TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|".
+func parseProbe(rest string) (*ServiceProbe, error) {
+	protocol, rest := splitDirective(rest)
+	name, rest := splitDirective(rest)
+	if protocol != "TCP" && protocol != "UDP" {
+		return nil, fmt.Errorf("invalid probe protocol %q", protocol)
+	}
+	if !strings.HasPrefix(rest, "q") {
+		return nil, fmt.Errorf("probe %s: missing probe string", name)
+	}
+	payload, _, _, err := parseDelimited(rest[1:])
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %v", name, err)
+	}
+	return &ServiceProbe{
+		Protocol:    strings.ToLower(protocol),
+		Name:        name,
+		Payload:     unescapeProbe(payload),
+		Rarity:      defaultRarity,
+		TotalWaitMS: defaultTotalWaitMS,
+	}, nil
+}
+
+// parseDelimited parses a value of the form <d>value<d>flags, where <d> is
+// any delimiter character, and returns the value, the flags and the
+// remainder of the input.
+func parseDelimited(s string) (value string, flags string, rest string, err error) {
+	if len(s) < 2 {
+		return "", "", "", fmt.Errorf("truncated value %q", s)
+	}
+	end := strings.IndexByte(s[1:], s[0])
+	if end < 0 {
+		return "", "", "", fmt.Errorf("unterminated value %q", s)
+	}
+	value, rest = s[1:end+1], s[end+2:]
+	i := strings.IndexAny(rest, " \t")
+	if i < 0 {
+		i = len(rest)
+	}
+	return value, rest[:i], strings.TrimSpace(rest[i:]), nil
+}
+
+// unescapeProbe decodes the C-style escapes allowed in probe strings.
+func unescapeProbe(s string) []byte {
+	var ret []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			ret = append(ret, s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case '0':
+			ret = append(ret, 0)
+		case 'a':
+			ret = append(ret, '\a')
+		case 'b':
+			ret = append(ret, '\b')
+		case 'f':
+			ret = append(ret, '\f')
+		case 'n':
+			ret = append(ret, '\n')
+		case 'r':
+			ret = append(ret, '\r')
+		case 't':
+			ret = append(ret, '\t')
+		case 'v':
+			ret = append(ret, '\v')
+		case 'x':
+			if i+2 < len(s) {
+				if b, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+					ret = append(ret, byte(b))
+					i += 2
+					continue
+				}
+			}
+			ret = append(ret, 'x')
+		default:
+			ret = append(ret, s[i])
+		}
+	}
+	return ret
+}
+
+// patternError is returned by parseMatch when a pattern is well-formed, but
+// cannot be compiled by the regexp package.
+type patternError struct {
+	err error
+}
+
+func (e *patternError) Error() string {
+	return e.err.Error()
+}
+
+// parseMatch parses the arguments of a match or softmatch directive, e.g.
+// "ssh m|^SSH-([\d.]+)-OpenSSH_([\w.]+)| p/OpenSSH/ v/$2/ cpe:/a:openbsd:openssh:$2/".
+func parseMatch(rest string, soft bool) (*ServiceMatcher, error) {
+	service, rest := splitDirective(rest)
+	if !strings.HasPrefix(rest, "m") {
+		return nil, fmt.Errorf("match %s: missing pattern", service)
+	}
+	pattern, options, rest, err := parseDelimited(rest[1:])
+	if err != nil {
+		return nil, fmt.Errorf("match %s: %v", service, err)
+	}
+	prefix := ""
+	if strings.Contains(options, "i") {
+		prefix += "(?i)"
+	}
+	if strings.Contains(options, "s") {
+		prefix += "(?s)"
+	}
+	// Responses are matched as Latin-1 text (see latin1), so that \xHH
+	// escapes in the pattern match the byte HH, as they do in PCRE.
+	re, err := regexp.Compile(prefix + latin1([]byte(pattern)))
+	if err != nil {
+		return nil, &patternError{fmt.Errorf("match %s: %v", service, err)}
+	}
+	ret := &ServiceMatcher{Service: service, Soft: soft, Pattern: re}
+	for rest != "" {
+		var field, value string
+		if strings.HasPrefix(rest, "cpe:") {
+			field = "cpe"
+			value, _, rest, err = parseDelimited(rest[4:])
+		} else {
+			field = rest[:1]
+			value, _, rest, err = parseDelimited(rest[1:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("match %s: %v", service, err)
+		}
+		switch field {
+		case "p":
+			ret.Product = value
+		case "v":
+			ret.Version = value
+		case "i":
+			ret.Info = value
+		case "h":
+			ret.Hostname = value
+		case "o":
+			ret.OS = value
+		case "d":
+			ret.DeviceType = value
+		case "cpe":
+			ret.CPE = append(ret.CPE, "cpe:/"+value)
+		default:
+			return nil, fmt.Errorf("match %s: unknown version field %q", service, field)
+		}
+	}
+	return ret, nil
+}
+
+// latin1 decodes b as ISO 8859-1, mapping each byte to the rune of the same
+// value.
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// unlatin1 is the inverse of latin1.
+func unlatin1(s string) []byte {
+	ret := make([]byte, 0, len(s))
+	for _, r := range s {
+		ret = append(ret, byte(r))
+	}
+	return ret
+}
+
+// Probe returns the probe with the given name, or nil if there is none.
+func (p *ServiceProbes) Probe(name string) *ServiceProbe {
+	return p.byName[name]
+}
+
+// containsPort reports whether port is in ports.
+func containsPort(ports zgrab2.PortList, port uint) bool {
+	for _, r := range ports {
+		if port >= uint(r.First) && port <= uint(r.Last) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package banner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testServiceProbes = `# A small service probe database in the nmap-service-probes format.
+Exclude T:9100-9107,U:30000
+
+Probe TCP NULL q||
+totalwaitms 6000
+match ssh m|^SSH-([\d.]+)-OpenSSH_([\w._-]+)\r?\n| p/OpenSSH/ v/$2/ i/protocol $1/ cpe:/a:openbsd:openssh:$2/
+match ftp m/^220 \(vsFTPd ([-.\w]+)\)\r\n/ p/vsftpd/ v/$1/ cpe:/a:beasts:vsftpd:$1/
+match backref m|^(\w+) \1$| p/Unsupported/
+softmatch ftp m|^220[- ]|
+
+Probe TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|
+rarity 1
+ports 80,8000-8010
+sslports 443
+match http m|^HTTP/1\.[01] \d\d\d .*\r\nServer: nginx/([\d.]+)\r\n|s p/nginx/ v/$SUBST(1,".","_")/ cpe:/a:igor_sysoev:nginx:$1/
+softmatch http m|^HTTP/1\.[01] \d\d\d|
+
+Probe TCP Binary q|\x01\x02\0|
+rarity 8
+fallback GetRequest
+match binary m|^\xff\x01(..)|s p/Binary/ v/$I(1,">")/ i/$P(1)/
+
+Probe UDP DNSStatusRequest q|\0\0\x10\0\0\0\0\0\0\0\0\0|
+rarity 1
+ports 53
+match domain m|^\0\0\x90\x04| p/ISC BIND/
+`
+
+func loadTestProbes(t *testing.T) *ServiceProbes {
+	probes, err := ParseServiceProbes(strings.NewReader(testServiceProbes))
+	if err != nil {
+		t.Fatalf("ParseServiceProbes: %v", err)
+	}
+	return probes
+}
+
+func probeNames(probes []*ServiceProbe) []string {
+	var ret []string
+	for _, probe := range probes {
+		ret = append(ret, probe.Name)
+	}
+	return ret
+}
+
+func TestParseServiceProbes(t *testing.T) {
+	probes := loadTestProbes(t)
+	if names := probeNames(probes.Probes); !reflect.DeepEqual(names, []string{"NULL", "GetRequest", "Binary", "DNSStatusRequest"}) {
+		t.Errorf("wrong probes: %v", names)
+	}
+	if probes.Skipped != 1 {
+		t.Errorf("expected the backreference pattern to be skipped, got %d skipped", probes.Skipped)
+	}
+	if s := probes.ExcludeTCP.String(); s != "9100-9107" {
+		t.Errorf("wrong TCP exclusions: %s", s)
+	}
+	if s := probes.ExcludeUDP.String(); s != "30000" {
+		t.Errorf("wrong UDP exclusions: %s", s)
+	}
+
+	null := probes.Probe("NULL")
+	if len(null.Payload) != 0 || null.TotalWaitMS != 6000 || null.Rarity != defaultRarity || len(null.Matches) != 3 {
+		t.Errorf("wrong NULL probe: %+v", null)
+	}
+	get := probes.Probe("GetRequest")
+	if string(get.Payload) != "GET / HTTP/1.0\r\n\r\n" || get.Rarity != 1 || get.Ports.String() != "80,8000-8010" || get.SSLPorts.String() != "443" {
+		t.Errorf("wrong GetRequest probe: %+v", get)
+	}
+	binary := probes.Probe("Binary")
+	if string(binary.Payload) != "\x01\x02\x00" || !reflect.DeepEqual(binary.Fallback, []string{"GetRequest"}) {
+		t.Errorf("wrong Binary probe: %+v", binary)
+	}
+	ssh := null.Matches[0]
+	if ssh.Service != "ssh" || ssh.Soft || ssh.Product != "OpenSSH" || ssh.Version != "$2" || ssh.Info != "protocol $1" ||
+		!reflect.DeepEqual(ssh.CPE, []string{"cpe:/a:openbsd:openssh:$2"}) {
+		t.Errorf("wrong ssh match: %+v", ssh)
+	}
+	if !null.Matches[2].Soft {
+		t.Errorf("expected a softmatch: %+v", null.Matches[2])
+	}
+}
+
+func TestParseServiceProbesErrors(t *testing.T) {
+	tests := []string{
+		"match ssh m|^SSH-|",
+		"Probe SCTP Foo q||",
+		"Probe TCP Foo q|unterminated",
+		"Probe TCP Foo q||\nmatch ssh m|^SSH-| x/bad/",
+		"Probe TCP Foo q||\nports 80-",
+		"Probe TCP Foo q||\nfallback Missing",
+	}
+	for _, test := range tests {
+		if _, err := ParseServiceProbes(strings.NewReader(test)); err == nil {
+			t.Errorf("expected an error parsing %q", test)
+		}
+	}
+}
+
+func TestSelectProbes(t *testing.T) {
+	probes := loadTestProbes(t)
+	tests := []struct {
+		protocol  string
+		port      uint
+		intensity int
+		expected  []string
+	}{
+		{"tcp", 22, 7, []string{"NULL", "GetRequest"}},
+		{"tcp", 22, 9, []string{"NULL", "GetRequest", "Binary"}},
+		{"tcp", 22, 0, []string{"NULL"}},
+		{"tcp", 8005, 0, []string{"NULL", "GetRequest"}},
+		{"tcp", 443, 0, []string{"NULL", "GetRequest"}},
+		{"tcp", 9101, 9, nil},
+		{"udp", 53, 0, []string{"DNSStatusRequest"}},
+		{"udp", 30000, 9, nil},
+	}
+	for _, test := range tests {
+		names := probeNames(probes.SelectProbes(test.protocol, test.port, test.intensity))
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("wrong probes for %s/%d at intensity %d (got %v; expected %v)", test.protocol, test.port, test.intensity, names, test.expected)
+		}
+	}
+}
+
+func TestMatchResponse(t *testing.T) {
+	probes := loadTestProbes(t)
+	tests := []struct {
+		probe    string
+		response string
+		expected *ServiceMatch
+	}{
+		{
+			probe:    "NULL",
+			response: "SSH-2.0-OpenSSH_7.4\r\n",
+			expected: &ServiceMatch{Probe: "NULL", Service: "ssh", Product: "OpenSSH", Version: "7.4", Info: "protocol 2.0", CPE: []string{"cpe:/a:openbsd:openssh:7.4"}},
+		},
+		{
+			probe:    "NULL",
+			response: "220 (vsFTPd 3.0.3)\r\n",
+			expected: &ServiceMatch{Probe: "NULL", Service: "ftp", Product: "vsftpd", Version: "3.0.3", CPE: []string{"cpe:/a:beasts:vsftpd:3.0.3"}},
+		},
+		{
+			probe:    "NULL",
+			response: "220 ProFTPD Server ready\r\n",
+			expected: &ServiceMatch{Probe: "NULL", Service: "ftp", SoftMatch: true},
+		},
+		{
+			probe:    "GetRequest",
+			response: "HTTP/1.1 200 OK\r\nServer: nginx/1.18.0\r\n\r\n",
+			expected: &ServiceMatch{Probe: "GetRequest", Service: "http", Product: "nginx", Version: "1_18_0", CPE: []string{"cpe:/a:igor_sysoev:nginx:1.18.0"}},
+		},
+		{
+			// Matched by the NULL probe, which every TCP probe falls back to.
+			probe:    "GetRequest",
+			response: "SSH-2.0-OpenSSH_8.0\r\nProtocol mismatch.\r\n",
+			expected: &ServiceMatch{Probe: "GetRequest", Service: "ssh", Product: "OpenSSH", Version: "8.0", Info: "protocol 2.0", CPE: []string{"cpe:/a:openbsd:openssh:8.0"}},
+		},
+		{
+			probe:    "Binary",
+			response: "\xff\x01\x01\x41",
+			expected: &ServiceMatch{Probe: "Binary", Service: "binary", Product: "Binary", Version: "321", Info: "A"},
+		},
+		{
+			// Matched by the explicit fallback.
+			probe:    "Binary",
+			response: "HTTP/1.0 400 Bad Request\r\n",
+			expected: &ServiceMatch{Probe: "Binary", Service: "http", SoftMatch: true},
+		},
+		{
+			probe:    "DNSStatusRequest",
+			response: "\x00\x00\x90\x04\x00\x00",
+			expected: &ServiceMatch{Probe: "DNSStatusRequest", Service: "domain", Product: "ISC BIND"},
+		},
+		{
+			probe:    "DNSStatusRequest",
+			response: "SSH-2.0-OpenSSH_7.4\r\n",
+			expected: nil,
+		},
+	}
+	for _, test := range tests {
+		match := probes.MatchResponse(probes.Probe(test.probe), []byte(test.response))
+		if !reflect.DeepEqual(match, test.expected) {
+			t.Errorf("wrong match for %s response %q (got %+v; expected %+v)", test.probe, test.response, match, test.expected)
+		}
+	}
+}
@@ -1,9 +1,15 @@
 // Package banner provides simple banner grab and matching implementation of the zgrab2.Module.
 // It sends a customizble probe (default to "\n") and filters the results based on custom regexp (--pattern)
+//
+// Alternatively, given a database of service probes in the nmap-service-probes
+// format (--service-probes), it sends the probes applicable to the port over
+// TCP or UDP (--udp) and identifies the service, product and version from the
+// responses.
 
 package banner
 
 import (
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -12,7 +18,8 @@ import (
 	"net"
 	"regexp"
 	"strconv"
-	"encoding/hex"
+	"strings"
+	"time"
 
 	"github.com/zmap/zgrab2"
 )
@@ -26,7 +33,12 @@ type Flags struct {
 	UseTLS    bool   `long:"tls" description:"Sends probe with TLS connection. Loads TLS module command options. "`
 	MaxTries  int    `long:"max-tries" default:"1" description:"Number of tries for timeouts and connection errors before giving up. Includes making TLS connection if enabled."`
 	Hex       bool   `long:"hex" description:"Store banner value in hex. "`
+
+	ServiceProbes    string `long:"service-probes" description:"Identify the service using the probes in this nmap-service-probes format file, instead of --probe and --pattern"`
+	VersionIntensity int    `long:"version-intensity" default:"7" description:"Send service probes with a rarity up to this value (0-9). Probes registered for the port are always sent."`
+	UDP              bool   `long:"udp" description:"Send the service probes over UDP. Requires --service-probes."`
 	zgrab2.TLSFlags
+	zgrab2.UDPFlags
 }
 
 // Module is the implementation of the zgrab2.Module interface.
@@ -35,15 +47,19 @@ type Module struct {
 
 // Scanner is the implementation of the zgrab2.Scanner interface.
 type Scanner struct {
-	config *Flags
-	regex  *regexp.Regexp
-	probe  []byte
+	config        *Flags
+	regex         *regexp.Regexp
+	probe         []byte
+	serviceProbes *ServiceProbes
 }
 
 // ScanResults instances are returned by the module's Scan function.
 type Results struct {
 	Banner string `json:"banner,omitempty"`
 	Length int    `json:"length,omitempty"`
+
+	// Match is the service identified with --service-probes, if any.
+	Match *ServiceMatch `json:"match,omitempty"`
 }
 
 // RegisterModule is called by modules/banner.go to register the scanner.
@@ -91,6 +107,27 @@ func (f *Flags) Validate(args []string) error {
 		log.Fatal("Cannot set both --probe and --probe-file")
 		return zgrab2.ErrInvalidArguments
 	}
+	if f.UDP && f.ServiceProbes == "" {
+		log.Fatal("--udp requires --service-probes")
+		return zgrab2.ErrInvalidArguments
+	}
+	if f.UDP && f.UseTLS {
+		log.Fatal("Cannot set both --udp and --tls")
+		return zgrab2.ErrInvalidArguments
+	}
+	if f.VersionIntensity < 0 || f.VersionIntensity > 9 {
+		log.Fatal("--version-intensity must be in the range [0,9]")
+		return zgrab2.ErrInvalidArguments
+	}
+	return nil
+}
+
+// GetUDPFlags returns the UDP options when the probes are sent over UDP, and
+// nil otherwise.
+func (f *Flags) GetUDPFlags() *zgrab2.UDPFlags {
+	if f.UDP {
+		return &f.UDPFlags
+	}
 	return nil
 }
 
@@ -123,22 +160,38 @@ func (scanner *Scanner) Init(flags zgrab2.ScanFlags) error {
 		}
 		scanner.probe = []byte(strProbe)
 	}
+	if f.ServiceProbes != "" {
+		scanner.serviceProbes, err = LoadServiceProbes(f.ServiceProbes)
+		if err != nil {
+			log.Fatalf("Failed to load service probes: %v", err)
+			return zgrab2.ErrInvalidArguments
+		}
+		if scanner.serviceProbes.Skipped > 0 {
+			log.Printf("Skipped %d service probe patterns that are not supported by Go regular expressions", scanner.serviceProbes.Skipped)
+		}
+	}
 
 	return nil
 }
 
 var NoMatchError = errors.New("pattern did not match")
 
-func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	try := 0
+// dial connects to the target, retrying up to --max-tries times, and performs
+// the TLS handshake if --tls is set.
+func (scanner *Scanner) dial(target *zgrab2.ScanTarget) (net.Conn, error) {
 	var (
 		conn    net.Conn
 		tlsConn *zgrab2.TLSConnection
 		err     error
-		readerr error
 	)
-	for try < scanner.config.MaxTries {
-		try++
+	for try := 0; try < scanner.config.MaxTries; try++ {
+		if scanner.config.UDP {
+			conn, err = target.OpenUDP(&scanner.config.BaseFlags, &scanner.config.UDPFlags)
+			if err != nil {
+				continue
+			}
+			break
+		}
 		conn, err = target.Open(&scanner.config.BaseFlags)
 		if err != nil {
 			continue
@@ -156,13 +209,22 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 
 		break
 	}
+	return conn, err
+}
+
+func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	if scanner.serviceProbes != nil {
+		return scanner.scanServiceProbes(&target)
+	}
+	var readerr error
+	conn, err := scanner.dial(&target)
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
 	defer conn.Close()
 
 	var ret []byte
-	try = 0
+	try := 0
 	for try < scanner.config.MaxTries {
 		try++
 		_, err = conn.Write(scanner.probe)
@@ -194,3 +256,118 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	return zgrab2.SCAN_PROTOCOL_ERROR, &results, NoMatchError
 
 }
+
+// ErrNoServiceMatch is returned when the target answered the service probes,
+// but none of the responses matched.
+var ErrNoServiceMatch = errors.New("no service probe matched")
+
+// scanServiceProbes sends the applicable service probes to the target, one
+// connection per probe, until a response positively identifies the service.
+// A softmatch is kept while the remaining probes are tried. The banner in the
+// results is the response that matched, or else the first non-empty one.
+func (scanner *Scanner) scanServiceProbes(target *zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
+	protocol := "tcp"
+	if scanner.config.UDP {
+		protocol = "udp"
+	}
+	port := scanner.config.Port
+	if target.Port != nil {
+		port = *target.Port
+	}
+	var (
+		results Results
+		banner  []byte
+		lastErr error
+	)
+	for _, probe := range scanner.serviceProbes.SelectProbes(protocol, port, scanner.config.VersionIntensity) {
+		response, err := scanner.sendServiceProbe(target, probe)
+		if len(response) == 0 {
+			if err != nil {
+				lastErr = err
+				status := zgrab2.TryGetScanStatus(err)
+				switch status {
+				case zgrab2.SCAN_CONNECTION_REFUSED, zgrab2.SCAN_CONNECTION_TIMEOUT, zgrab2.SCAN_HOST_UNREACHABLE, zgrab2.SCAN_NETWORK_UNREACHABLE, zgrab2.SCAN_DNS_NOT_FOUND, zgrab2.SCAN_DNS_ERROR:
+					return status, nil, err
+				}
+			}
+			continue
+		}
+		match := scanner.serviceProbes.MatchResponse(probe, response)
+		if match == nil {
+			if banner == nil {
+				banner = response
+			}
+			continue
+		}
+		if results.Match == nil || (results.Match.SoftMatch && !match.SoftMatch) {
+			results.Match = match
+			banner = response
+		}
+		if !match.SoftMatch {
+			break
+		}
+	}
+	if scanner.config.Hex {
+		results.Banner = hex.EncodeToString(banner)
+	} else {
+		results.Banner = string(banner)
+	}
+	results.Length = len(banner)
+	if results.Match != nil {
+		return zgrab2.SCAN_SUCCESS, &results, nil
+	}
+	if banner != nil {
+		return zgrab2.SCAN_PROTOCOL_ERROR, &results, ErrNoServiceMatch
+	}
+	if lastErr == nil {
+		lastErr = ErrNoServiceMatch
+	}
+	return zgrab2.TryGetScanStatus(lastErr), nil, lastErr
+}
+
+// sendServiceProbe sends a single service probe on a new connection and
+// returns whatever the target sends back within the probe's wait time
+// (capped by --timeout).
+func (scanner *Scanner) sendServiceProbe(target *zgrab2.ScanTarget, probe *ServiceProbe) ([]byte, error) {
+	conn, err := scanner.dial(target)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if len(probe.Payload) > 0 {
+		if _, err := conn.Write(probe.Payload); err != nil {
+			return nil, err
+		}
+	}
+	wait := time.Duration(probe.TotalWaitMS) * time.Millisecond
+	if timeout := scanner.config.GetReadTimeout(); timeout > 0 && timeout < wait {
+		wait = timeout
+	}
+	conn.SetReadDeadline(time.Now().Add(wait))
+	response, err := zgrab2.ReadAvailableWithOptions(conn, 8209, 100*time.Millisecond, wait, 1024*512)
+	if err == io.EOF || zgrab2.IsTimeoutError(err) {
+		err = nil
+	}
+	return response, err
+}
+
+// IdentifyService reports the product and version from the service probe
+// match, if any.
+func (scanner *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*Results)
+	if !ok || r == nil || r.Match == nil || r.Match.Product == "" {
+		return nil
+	}
+	info := &zgrab2.ServiceInfo{Product: r.Match.Product, Version: r.Match.Version, Confidence: 10}
+	if r.Match.SoftMatch {
+		info.Confidence = 5
+	}
+	for _, cpe := range r.Match.CPE {
+		if strings.HasPrefix(cpe, "cpe:/a:") {
+			info.CPE = zgrab2.CPEFromURI(cpe)
+			info.Vendor = strings.SplitN(cpe[len("cpe:/a:"):], ":", 2)[0]
+			break
+		}
+	}
+	return info
+}
@@ -143,6 +143,21 @@ return zgrab2.SCAN_SUCCESS, results, nil
 
 
 }
+// IdentifyService reports the distccd version extracted from the banner.
+func (s *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*ScanResults)
+	if !ok || r == nil || r.ServiceName != "distccd" {
+		return nil
+	}
+	info := &zgrab2.ServiceInfo{Product: "distccd", Vendor: "samba", Confidence: 8}
+	if r.Version != "unknown" {
+		info.Version = r.Version
+		info.Confidence = 10
+	}
+	info.CPE = zgrab2.FormatCPE("samba", "distcc", info.Version)
+	return info
+}
+
 func extractServiceAndVersion(banner string) (string, string) {
 	serviceName := "unknown"
 	version := "unknown"
@@ -5,8 +5,8 @@ import (
 	"io"
 	"net"
 	"regexp"
+	"strconv"
 	"strings"
-	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
@@ -104,13 +104,21 @@ func (scanner *Scanner) GetTrigger() string {
 // Scan performs the configured scan on the EXEC service.
 // Scan performs the exec scan.
 func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{}, error) {
-	_, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// The whole exchange is bounded by the session timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), scanner.config.GetSessionTimeout())
 	defer cancel()
 
-	conn, err := t.Open(&scanner.config.BaseFlags)
+	port := scanner.config.Port
+	if t.Port != nil {
+		port = *t.Port
+	}
+	dialer := scanner.config.BaseFlags.NewDialer()
+	dialer.SourceIP = t.SourceIP()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(t.Host(), strconv.FormatUint(uint64(port), 10)))
 	if err != nil {
 		return zgrab2.TryGetScanStatus(err), nil, err
 	}
+	t.TrackConnection(conn)
 	defer conn.Close()
 
 	results := ScanResults{}
@@ -141,6 +149,16 @@ func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{
 	return zgrab2.SCAN_SUCCESS, &execConn.results, nil
 }
 
+// IdentifyService reports the service and version named in the response.
+// The vendor is unknown, so no CPE is given.
+func (scanner *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*ScanResults)
+	if !ok || r == nil || r.Service == "" {
+		return nil
+	}
+	return &zgrab2.ServiceInfo{Product: r.Service, Version: r.Version, Confidence: 5}
+}
+
 // extractServiceAndVersion extracts service and version from a response using regular expressions.
 func extractServiceAndVersion(response string) (string, string) {
 	// Define regular expressions for matching service and version
@@ -284,3 +284,23 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 	}
 	return zgrab2.SCAN_SUCCESS, &ftp.results, nil
 }
+
+// ftpBanners identify common FTP servers by their banners.
+var ftpBanners = []zgrab2.BannerPattern{
+	{Regexp: regexp.MustCompile(`ProFTPD (\d[\w.]*)`), Product: "ProFTPD", Vendor: "proftpd", CPEProduct: "proftpd"},
+	{Regexp: regexp.MustCompile(`vsFTPd (\d[\w.]*)`), Product: "vsftpd", Vendor: "beasts", CPEProduct: "vsftpd"},
+	{Regexp: regexp.MustCompile(`FileZilla Server(?: version)? (\d[\w.]*)`), Product: "FileZilla ftpd", Vendor: "filezilla-project", CPEProduct: "filezilla_server"},
+	{Regexp: regexp.MustCompile(`Serv-U FTP Server v(\d[\w.]*)`), Product: "Serv-U ftpd", Vendor: "serv-u", CPEProduct: "serv-u"},
+	{Regexp: regexp.MustCompile(`Pure-FTPd`), Product: "Pure-FTPd", Vendor: "pureftpd", CPEProduct: "pure-ftpd"},
+	{Regexp: regexp.MustCompile(`Microsoft FTP Service`), Product: "Microsoft ftpd", Vendor: "microsoft", CPEProduct: "ftp_service"},
+}
+
+// IdentifyService reports the server software named in the banner, if it is
+// one of ftpBanners.
+func (s *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*ScanResults)
+	if !ok || r == nil {
+		return nil
+	}
+	return zgrab2.IdentifyBanner(r.Banner, ftpBanners)
+}
@@ -269,7 +269,12 @@ func (scan *scan) withDeadlineContext(ctx context.Context) context.Context {
 // Dial a connection using the configured timeouts, as well as the global deadline, and on success,
 // add the connection to the list of connections to be cleaned up.
 func (scan *scan) dialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
-	dialer := zgrab2.GetTimeoutConnectionDialer(scan.scanner.config.Timeout)
+	dialer := scan.scanner.config.BaseFlags.NewDialer()
+	// Connections to the target itself are made from its source IP, but not
+	// those to other hosts after a redirect.
+	if host, _, err := net.SplitHostPort(addr); err == nil && (host == scan.target.Domain || (scan.target.IP != nil && host == scan.target.IP.String())) {
+		dialer.SourceIP = scan.target.SourceIP()
+	}
 
 	switch network {
 	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
@@ -299,12 +304,13 @@ func (scan *scan) dialContext(ctx context.Context, network string, addr string)
 		}
 	}
 
-	timeoutContext, _ := context.WithTimeout(context.Background(), scan.scanner.config.Timeout)
+	timeoutContext, _ := context.WithTimeout(context.Background(), scan.scanner.config.GetSessionTimeout())
 
 	conn, err := dialer.DialContext(scan.withDeadlineContext(timeoutContext), network, addr)
 	if err != nil {
 		return nil, err
 	}
+	scan.target.TrackConnection(conn)
 	scan.connections = append(scan.connections, conn)
 	return conn, nil
 }
@@ -455,7 +461,7 @@ func (scanner *Scanner) newHTTPScan(t *zgrab2.ScanTarget, useHTTPS bool) *scan {
 			MaxIdleConnsPerHost: scanner.config.MaxRedirects,
 		},
 		client:         http.MakeNewClient(),
-		globalDeadline: time.Now().Add(scanner.config.Timeout),
+		globalDeadline: time.Now().Add(scanner.config.GetSessionTimeout()),
 	}
 	ret.transport.DialTLS = ret.getTLSDialer(t)
 	ret.transport.DialContext = ret.dialContext
@@ -463,7 +469,7 @@ func (scanner *Scanner) newHTTPScan(t *zgrab2.ScanTarget, useHTTPS bool) *scan {
 	ret.client.CheckRedirect = ret.getCheckRedirect()
 	ret.client.Transport = ret.transport
 	ret.client.Jar = nil // Don't send or receive cookies (otherwise use CookieJar)
-	ret.client.Timeout = scanner.config.Timeout
+	ret.client.Timeout = scanner.config.GetSessionTimeout()
 	host := t.Domain
 	if host == "" {
 		host = t.IP.String()
@@ -630,6 +636,41 @@ func (scanner *Scanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{
 	return zgrab2.SCAN_SUCCESS, &scan.results, nil
 }
 
+// httpVendors maps the product names found in HTTP Server headers to their
+// CPE vendor and product names.
+var httpVendors = map[string][2]string{
+	"apache":        {"apache", "http_server"},
+	"nginx":         {"f5", "nginx"},
+	"microsoft-iis": {"microsoft", "internet_information_services"},
+	"lighttpd":      {"lighttpd", "lighttpd"},
+	"openresty":     {"openresty", "openresty"},
+	"caddy":         {"caddyserver", "caddy"},
+	"jetty":         {"eclipse", "jetty"},
+}
+
+// IdentifyService reports the product and version from the Server header of
+// the final response, e.g. "Apache/2.4.41 (Ubuntu)".
+func (scanner *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*Results)
+	if !ok || r == nil || r.Response == nil {
+		return nil
+	}
+	server := strings.TrimSpace(r.Response.Header.Get("Server"))
+	if server == "" {
+		return nil
+	}
+	product := strings.Fields(server)[0]
+	info := &zgrab2.ServiceInfo{Product: product, Confidence: 7}
+	if i := strings.Index(product, "/"); i > 0 {
+		info.Product, info.Version = product[:i], product[i+1:]
+	}
+	if cpe, ok := httpVendors[strings.ToLower(info.Product)]; ok {
+		info.Vendor = cpe[0]
+		info.CPE = zgrab2.FormatCPE(cpe[0], cpe[1], info.Version)
+	}
+	return info
+}
+
 // RegisterModule is called by modules/http.go to register this module with the
 // zgrab2 framework.
 func RegisterModule() {
@@ -25,6 +25,7 @@ package imap
 import (
 	"fmt"
 	"errors"
+	"regexp"
 
 	"strings"
 
@@ -241,3 +242,21 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	}
 	return sr, result, nil
 }
+
+// imapBanners identify common IMAP servers by their banners.
+var imapBanners = []zgrab2.BannerPattern{
+	{Regexp: regexp.MustCompile(`Dovecot`), Product: "Dovecot imapd", Vendor: "dovecot", CPEProduct: "dovecot"},
+	{Regexp: regexp.MustCompile(`Courier-IMAP`), Product: "Courier Imapd", Vendor: "double_precision_incorporated", CPEProduct: "courier-imap"},
+	{Regexp: regexp.MustCompile(`Cyrus IMAP4? v(\d[\w.]*)`), Product: "Cyrus imapd", Vendor: "cmu", CPEProduct: "cyrus_imap_server"},
+	{Regexp: regexp.MustCompile(`Microsoft Exchange`), Product: "Microsoft Exchange imapd", Vendor: "microsoft", CPEProduct: "exchange_server"},
+}
+
+// IdentifyService reports the server software named in the banner, if it is
+// one of imapBanners.
+func (scanner *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*ScanResults)
+	if !ok || r == nil {
+		return nil
+	}
+	return zgrab2.IdentifyBanner(r.Banner, imapBanners)
+}
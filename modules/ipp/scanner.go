@@ -4,6 +4,7 @@ package ipp
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"errors"
@@ -633,12 +634,15 @@ func (scan *scan) getCheckRedirect(scanner *Scanner) func(*http.Request, *http.R
 }
 
 // Taken from zgrab2 http library, slightly modified to use slightly leaner scan object
-func (scan *scan) getTLSDialer(scanner *Scanner) func(net, addr string) (net.Conn, error) {
-	return func(net, addr string) (net.Conn, error) {
-		outer, err := zgrab2.DialTimeoutConnection(net, addr, scanner.config.BaseFlags.Timeout, 0)
+func (scan *scan) getTLSDialer(scanner *Scanner, target *zgrab2.ScanTarget) func(network, addr string) (net.Conn, error) {
+	dialer := scanner.config.BaseFlags.NewDialer()
+	dialer.SourceIP = target.SourceIP()
+	return func(network, addr string) (net.Conn, error) {
+		outer, err := dialer.DialContext(context.Background(), network, addr)
 		if err != nil {
 			return nil, err
 		}
+		target.TrackConnection(outer)
 		scan.connections = append(scan.connections, outer)
 		tlsConn, err := scanner.config.TLSFlags.GetTLSConnection(outer)
 		if err != nil {
@@ -675,8 +679,16 @@ func (scanner *Scanner) newIPPScan(target *zgrab2.ScanTarget, tls bool) *scan {
 		DisableCompression:  false,
 		MaxIdleConnsPerHost: scanner.config.MaxRedirects,
 	}
-	transport.DialTLS = newScan.getTLSDialer(scanner)
-	transport.DialContext = zgrab2.GetTimeoutConnectionDialer(scanner.config.Timeout).DialContext
+	transport.DialTLS = newScan.getTLSDialer(scanner, target)
+	dialer := scanner.config.BaseFlags.NewDialer()
+	dialer.SourceIP = target.SourceIP()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err == nil {
+			target.TrackConnection(conn)
+		}
+		return conn, err
+	}
 	newScan.client.CheckRedirect = newScan.getCheckRedirect(scanner)
 	newScan.client.UserAgent = scanner.config.UserAgent
 	newScan.client.Transport = transport
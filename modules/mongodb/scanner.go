@@ -363,6 +363,21 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	return zgrab2.SCAN_SUCCESS, &result, err
 }
 
+// IdentifyService reports the server version from the buildInfo response.
+func (scanner *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*Result)
+	if !ok || r == nil || r.BuildInfo == nil || r.BuildInfo.Version == "" {
+		return nil
+	}
+	return &zgrab2.ServiceInfo{
+		Product:    "MongoDB",
+		Version:    r.BuildInfo.Version,
+		Vendor:     "mongodb",
+		CPE:        zgrab2.FormatCPE("mongodb", "mongodb", r.BuildInfo.Version),
+		Confidence: 10,
+	}
+}
+
 // RegisterModule registers the zgrab2 module.
 func RegisterModule() {
 	var module Module
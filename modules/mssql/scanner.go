@@ -183,3 +183,18 @@ func RegisterModule() {
 		log.Fatal(err)
 	}
 }
+
+// IdentifyService reports the server version from the PRELOGIN response.
+func (scanner *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*ScanResults)
+	if !ok || r == nil || r.Version == "" {
+		return nil
+	}
+	return &zgrab2.ServiceInfo{
+		Product:    "Microsoft SQL Server",
+		Version:    r.Version,
+		Vendor:     "microsoft",
+		CPE:        zgrab2.FormatCPE("microsoft", "sql_server", r.Version),
+		Confidence: 10,
+	}
+}
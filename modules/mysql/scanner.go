@@ -6,6 +6,7 @@ package mysql
 
 import (
 	"reflect"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
@@ -255,3 +256,25 @@ func (s *Scanner) Scan(t zgrab2.ScanTarget) (status zgrab2.ScanStatus, result in
 	// If we made it this far, the scan was a success. The result will be grabbed in the defer block above.
 	return zgrab2.SCAN_SUCCESS, nil, nil
 }
+
+// IdentifyService reports the server version from the handshake packet,
+// distinguishing MariaDB (which reports e.g. "10.3.22-MariaDB-1") from MySQL.
+func (s *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*ScanResults)
+	if !ok || r == nil || r.ServerVersion == "" {
+		return nil
+	}
+	info := &zgrab2.ServiceInfo{Product: "MySQL", Vendor: "oracle", Confidence: 10}
+	version := r.ServerVersion
+	if strings.Contains(version, "MariaDB") {
+		info.Product, info.Vendor = "MariaDB", "mariadb"
+		// MariaDB 10+ prefixes the real version with "5.5.5-" for compatibility.
+		version = strings.TrimPrefix(version, "5.5.5-")
+	}
+	if i := strings.Index(version, "-"); i > 0 {
+		version = version[:i]
+	}
+	info.Version = version
+	info.CPE = zgrab2.FormatCPE(info.Vendor, strings.ToLower(info.Product), version)
+	return info
+}
@@ -28,6 +28,7 @@ package pop3
 import (
 	"fmt"
 	"errors"
+	"regexp"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
@@ -269,3 +270,20 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	}
 	return sr, result, nil
 }
+
+// pop3Banners identify common POP3 servers by their banners.
+var pop3Banners = []zgrab2.BannerPattern{
+	{Regexp: regexp.MustCompile(`Dovecot`), Product: "Dovecot pop3d", Vendor: "dovecot", CPEProduct: "dovecot"},
+	{Regexp: regexp.MustCompile(`Cyrus POP3 v(\d[\w.]*)`), Product: "Cyrus pop3d", Vendor: "cmu", CPEProduct: "cyrus_imap_server"},
+	{Regexp: regexp.MustCompile(`Microsoft Exchange`), Product: "Microsoft Exchange pop3d", Vendor: "microsoft", CPEProduct: "exchange_server"},
+}
+
+// IdentifyService reports the server software named in the banner, if it is
+// one of pop3Banners.
+func (scanner *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*ScanResults)
+	if !ok || r == nil {
+		return nil
+	}
+	return zgrab2.IdentifyBanner(r.Banner, pop3Banners)
+}
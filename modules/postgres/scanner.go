@@ -544,3 +544,27 @@ func RegisterModule() {
 		log.Fatal(err)
 	}
 }
+
+// IdentifyService reports the server version from the server_version
+// parameter, which is only sent once a startup succeeds. Without it, any
+// PostgreSQL response still identifies the server, but not its version.
+func (s *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*Results)
+	if !ok || r == nil {
+		return nil
+	}
+	info := &zgrab2.ServiceInfo{Product: "PostgreSQL", Vendor: "postgresql", Confidence: 8}
+	if r.ServerParameters != nil {
+		// e.g. "12.3 (Debian 12.3-1.pgdg100+1)"
+		if fields := strings.Fields((*r.ServerParameters)["server_version"]); len(fields) > 0 {
+			info.Version = fields[0]
+			info.Confidence = 10
+		}
+	}
+	if info.Version == "" && r.SupportedVersions == "" && r.ProtocolError == nil &&
+		r.StartupError == nil && r.UserStartupError == nil && r.AuthenticationMode == nil {
+		return nil
+	}
+	info.CPE = zgrab2.FormatCPE("postgresql", "postgresql", info.Version)
+	return info
+}
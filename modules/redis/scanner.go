@@ -511,3 +511,25 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	result.TLSLog = scan.conn.GetTLSLog()
 	return zgrab2.SCAN_SUCCESS, &result, nil
 }
+
+// IdentifyService reports the redis server version scraped from the INFO
+// response.
+func (scanner *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	var r *Result
+	switch v := result.(type) {
+	case *Result:
+		r = v
+	case **Result:
+		r = *v
+	}
+	if r == nil || r.Version == "" {
+		return nil
+	}
+	return &zgrab2.ServiceInfo{
+		Product:    "Redis",
+		Version:    r.Version,
+		Vendor:     "redis",
+		CPE:        zgrab2.FormatCPE("redis", "redis", r.Version),
+		Confidence: 10,
+	}
+}
@@ -1,12 +1,12 @@
 package rmiregistry
 
 import (
-	"fmt"
+	"context"
 	"net"
 	"strings"
     	"net/rpc"
 	"regexp"
-	"time"
+	"strconv"
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
 )
@@ -151,23 +151,22 @@ type YourRMIResult struct {
 func (s *Scanner) Scan(target zgrab2.ScanTarget) (status zgrab2.ScanStatus, result interface{}, thrown error) {
     var err error
 
-    // Set the timeout duration to a longer value (e.g., 10 seconds).
-    timeoutDuration := 50 * time.Second
-
-    // Create a dialer with the specified timeout.
-    dialer := &net.Dialer{
-        Timeout: timeoutDuration,
-    }
-
     // Build the address for the connection using the target's IP and Port.
-    address := fmt.Sprintf("%s:%d", target.IP, target.Port)
+    port := s.config.Port
+    if target.Port != nil {
+        port = *target.Port
+    }
+    address := net.JoinHostPort(target.Host(), strconv.FormatUint(uint64(port), 10))
 
-    // Establish a network connection with the specified timeout.
-    conn, err := dialer.Dial("tcp", address)
+    // Establish a network connection with the configured timeouts, from the
+    // source address recorded for the target.
+    dialer := s.config.BaseFlags.NewDialer()
+    dialer.SourceIP = target.SourceIP()
+    conn, err := dialer.DialContext(context.Background(), "tcp", address)
     if err != nil {
-        fmt.Println("Error opening connection:", err)
         return zgrab2.TryGetScanStatus(err), nil, err
     }
+    target.TrackConnection(conn)
     cn := conn
     defer func() {
         cn.Close()
@@ -191,7 +190,6 @@ func (s *Scanner) Scan(target zgrab2.ScanTarget) (status zgrab2.ScanStatus, resu
     // Call the RMI method on the specified object (registry).
     err = client.Call(rmiMethodName, rmiMethodArgs, &rmiResult)
     if err != nil {
-        fmt.Println("Error calling RMI method:", err)
         return zgrab2.SCAN_UNKNOWN_ERROR, nil, err
     }
 
@@ -28,6 +28,7 @@ package smtp
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -329,3 +330,22 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	}
 	return sr, result, nil
 }
+
+// smtpBanners identify common mail servers by their banners.
+var smtpBanners = []zgrab2.BannerPattern{
+	{Regexp: regexp.MustCompile(`ESMTP Postfix`), Product: "Postfix smtpd", Vendor: "postfix", CPEProduct: "postfix"},
+	{Regexp: regexp.MustCompile(`Exim (\d[\w.]*)`), Product: "Exim smtpd", Vendor: "exim", CPEProduct: "exim"},
+	{Regexp: regexp.MustCompile(`Sendmail (\d[\w.]*)`), Product: "Sendmail", Vendor: "sendmail", CPEProduct: "sendmail"},
+	{Regexp: regexp.MustCompile(`OpenSMTPD`), Product: "OpenSMTPD", Vendor: "openbsd", CPEProduct: "opensmtpd"},
+	{Regexp: regexp.MustCompile(`Microsoft ESMTP MAIL Service(?:, Version: (\d[\w.]*))?`), Product: "Microsoft ESMTP"},
+}
+
+// IdentifyService reports the server software named in the banner, if it is
+// one of smtpBanners.
+func (scanner *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*ScanResults)
+	if !ok || r == nil {
+		return nil
+	}
+	return zgrab2.IdentifyBanner(r.Banner, smtpBanners)
+}
@@ -51,3 +51,42 @@ func TestVerifySMTPContents(t *testing.T) {
 	}
 
 }
+
+func TestIdentifyService(t *testing.T) {
+	tests := map[string]struct {
+		Banner  string
+		Product string
+		Version string
+	}{
+		"exim": {
+			Banner:  "220-some.host.com ESMTP Exim 4.93 #2 Thu, 04 Feb 2021 13:34:12 -0500 \r\n220 and/or bulk e-mail.",
+			Product: "Exim smtpd",
+			Version: "4.93",
+		},
+		"postfix": {
+			Banner:  "220 mail.example.com ESMTP Postfix (Ubuntu)",
+			Product: "Postfix smtpd",
+		},
+		"sendmail": {
+			Banner:  "220 mx.example.com ESMTP Sendmail 8.15.2/8.15.2; Thu, 4 Feb 2021 13:34:12 -0500",
+			Product: "Sendmail",
+			Version: "8.15.2",
+		},
+		"unknown": {
+			Banner: "220 mx.example.com ESMTP ready",
+		},
+	}
+	scanner := new(Scanner)
+	for name, test := range tests {
+		info := scanner.IdentifyService(&ScanResults{Banner: test.Banner})
+		if test.Product == "" {
+			if info != nil {
+				t.Errorf("%s: unexpected service %+v", name, info)
+			}
+			continue
+		}
+		if info == nil || info.Product != test.Product || info.Version != test.Version {
+			t.Errorf("%s: got %+v", name, info)
+		}
+	}
+}
@@ -96,7 +96,6 @@ func (s *SSHScanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{},
 	rhost := net.JoinHostPort(t.Host(), portStr)
 
 	sshConfig := ssh.MakeSSHConfig()
-	sshConfig.Timeout = s.config.Timeout
 	sshConfig.ConnLog = data
 	sshConfig.ClientVersion = s.config.ClientID
 	sshConfig.HelloOnly = s.config.HelloOnly
@@ -118,12 +117,53 @@ func (s *SSHScanner) Scan(t zgrab2.ScanTarget) (zgrab2.ScanStatus, interface{},
 		data.Banner = strings.TrimSpace(banner)
 		return nil
 	}
-	_, err := ssh.Dial("tcp", rhost, sshConfig)
+	// The connection is opened by the framework, so that it gets the
+	// configured timeouts.
+	conn, err := t.Open(&s.config.BaseFlags)
+	if err != nil {
+		return zgrab2.TryGetScanStatus(err), data, err
+	}
+	defer conn.Close()
+	_, _, _, err = ssh.NewClientConn(conn, rhost, sshConfig)
 	// TODO FIXME: Distinguish error types
 	status := zgrab2.TryGetScanStatus(err)
 	return status, data, err
 }
 
+// sshVendors maps the software names found in SSH identification strings to
+// their CPE vendor and product names.
+var sshVendors = map[string][2]string{
+	"openssh":  {"openbsd", "openssh"},
+	"dropbear": {"dropbear_ssh_project", "dropbear_ssh"},
+	"libssh":   {"libssh", "libssh"},
+	"cisco":    {"cisco", "ssh"},
+}
+
+// IdentifyService reports the software and version from the server's
+// identification string, e.g. "OpenSSH_7.4p1" or "dropbear_2019.78".
+func (s *SSHScanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	data, ok := result.(*ssh.HandshakeLog)
+	if !ok || data == nil || data.ServerID == nil {
+		return nil
+	}
+	// The server may send a blank software version.
+	fields := strings.Fields(data.ServerID.SoftwareVersion)
+	if len(fields) == 0 {
+		return nil
+	}
+	software := fields[0]
+	info := &zgrab2.ServiceInfo{Product: software, Confidence: 8}
+	if i := strings.LastIndexAny(software, "_-"); i > 0 && i+1 < len(software) && software[i+1] >= '0' && software[i+1] <= '9' {
+		info.Product, info.Version = software[:i], software[i+1:]
+		info.Confidence = 10
+	}
+	if cpe, ok := sshVendors[strings.ToLower(info.Product)]; ok {
+		info.Vendor = cpe[0]
+		info.CPE = zgrab2.FormatCPE(cpe[0], cpe[1], info.Version)
+	}
+	return info
+}
+
 // Protocol returns the protocol identifer for the scanner.
 func (s *SSHScanner) Protocol() string {
 	return "ssh"
@@ -0,0 +1,35 @@
+package modules
+
+import (
+	"testing"
+
+	"github.com/zmap/zgrab2/lib/ssh"
+)
+
+func TestSSHIdentifyService(t *testing.T) {
+	tests := []struct {
+		software string
+		product  string
+		version  string
+		cpe      string
+	}{
+		{"OpenSSH_7.4p1", "OpenSSH", "7.4p1", "cpe:2.3:a:openbsd:openssh:7.4p1:*:*:*:*:*:*:*"},
+		{"dropbear_2019.78", "dropbear", "2019.78", "cpe:2.3:a:dropbear_ssh_project:dropbear_ssh:2019.78:*:*:*:*:*:*:*"},
+		{"Custom SSH server", "Custom", "", ""},
+		{"", "", "", ""},
+		{"  \t", "", "", ""},
+	}
+	scanner := new(SSHScanner)
+	for _, test := range tests {
+		info := scanner.IdentifyService(&ssh.HandshakeLog{ServerID: &ssh.EndpointId{SoftwareVersion: test.software}})
+		if test.product == "" {
+			if info != nil {
+				t.Errorf("%q: unexpected service %+v", test.software, info)
+			}
+			continue
+		}
+		if info == nil || info.Product != test.product || info.Version != test.version || info.CPE != test.cpe {
+			t.Errorf("%q: got %+v", test.software, info)
+		}
+	}
+}
@@ -12,6 +12,8 @@
 package telnet
 
 import (
+	"regexp"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2"
 )
@@ -114,3 +116,21 @@ func (scanner *Scanner) Scan(target zgrab2.ScanTarget) (zgrab2.ScanStatus, inter
 	}
 	return zgrab2.SCAN_SUCCESS, result, nil
 }
+
+// telnetBanners identify common telnet servers by their banners. These name
+// devices rather than the telnet server software, so no CPE is given.
+var telnetBanners = []zgrab2.BannerPattern{
+	{Regexp: regexp.MustCompile(`MikroTik v(\d[\w.]*)`), Product: "MikroTik router telnetd"},
+	{Regexp: regexp.MustCompile(`User Access Verification`), Product: "Cisco router telnetd"},
+	{Regexp: regexp.MustCompile(`BusyBox v(\d[\w.]*)`), Product: "BusyBox telnetd"},
+}
+
+// IdentifyService reports the device named in the banner, if it is one of
+// telnetBanners.
+func (scanner *Scanner) IdentifyService(result interface{}) *zgrab2.ServiceInfo {
+	r, ok := result.(*TelnetLog)
+	if !ok || r == nil {
+		return nil
+	}
+	return zgrab2.IdentifyBanner(r.Banner, telnetBanners)
+}
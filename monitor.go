@@ -1,11 +1,16 @@
 package zgrab2
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 // Monitor is a collection of states per scans and a channel to communicate
 // those scans to the monitor
 type Monitor struct {
 	states       map[string]*State
+	metrics      map[string]map[ScanStatus]*ScanMetrics
+	mutex        sync.Mutex
 	statusesChan chan moduleStatus
 	// Callback is invoked after each scan.
 	Callback func(string)
@@ -21,6 +26,12 @@ type State struct {
 type moduleStatus struct {
 	name string
 	st   status
+
+	// status, duration and conns are the outcome of the scan, for the
+	// metrics.
+	status   ScanStatus
+	duration time.Duration
+	conns    []connectionStats
 }
 
 type status uint
@@ -33,7 +44,30 @@ const (
 // GetStatuses returns a mapping from scanner names to the current number
 // of successes and failures for that scanner
 func (m *Monitor) GetStatuses() map[string]*State {
-	return m.states
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ret := make(map[string]*State, len(m.states))
+	for name, state := range m.states {
+		copied := *state
+		ret[name] = &copied
+	}
+	return ret
+}
+
+// GetMetrics returns a mapping from scanner names to the metrics of their
+// scans, broken down by status.
+func (m *Monitor) GetMetrics() map[string]map[ScanStatus]*ScanMetrics {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ret := make(map[string]map[ScanStatus]*ScanMetrics, len(m.metrics))
+	for name, byStatus := range m.metrics {
+		ret[name] = make(map[ScanStatus]*ScanMetrics, len(byStatus))
+		for status, metrics := range byStatus {
+			copied := *metrics
+			ret[name][status] = &copied
+		}
+	}
+	return ret
 }
 
 // Stop indicates the monitor is done and the internal channel should be closed.
@@ -49,23 +83,36 @@ func MakeMonitor(statusChanSize int, wg *sync.WaitGroup) *Monitor {
 	m := new(Monitor)
 	m.statusesChan = make(chan moduleStatus, statusChanSize)
 	m.states = make(map[string]*State, 10)
+	m.metrics = make(map[string]map[ScanStatus]*ScanMetrics, 10)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for s := range m.statusesChan {
+			m.mutex.Lock()
 			if m.states[s.name] == nil {
 				m.states[s.name] = new(State)
 			}
-			if m.Callback != nil {
-				m.Callback(s.name)
-			}
 			switch s.st {
 			case statusSuccess:
 				m.states[s.name].Successes++
 			case statusFailure:
 				m.states[s.name].Failures++
-			default:
-				continue
+			}
+			if s.status != "" {
+				if m.metrics[s.name] == nil {
+					m.metrics[s.name] = make(map[ScanStatus]*ScanMetrics)
+				}
+				if m.metrics[s.name][s.status] == nil {
+					m.metrics[s.name][s.status] = new(ScanMetrics)
+				}
+				m.metrics[s.name][s.status].record(s.duration, s.conns)
+			}
+			m.mutex.Unlock()
+			if s.status != "" {
+				observe(s.name, s.status, s.duration, s.conns)
+			}
+			if m.Callback != nil {
+				m.Callback(s.name)
 			}
 		}
 	}()
@@ -0,0 +1,335 @@
+package zgrab2
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// encodedGrab is the subset of an encoded Grab used to render nmap-style
+// output.
+type encodedGrab struct {
+	IP     string                         `json:"ip"`
+	Domain string                         `json:"domain"`
+	Port   uint                           `json:"port"`
+	Data   map[string]encodedScanResponse `json:"data"`
+}
+
+type encodedScanResponse struct {
+	Status   ScanStatus      `json:"status"`
+	Protocol string          `json:"protocol"`
+	Result   json.RawMessage `json:"result"`
+	Service  *ServiceInfo    `json:"service"`
+}
+
+// nmapPort is a single port of a host, merged from the responses of every
+// module that scanned it.
+type nmapPort struct {
+	protocol string
+	port     uint
+	state    string
+	reason   string
+	service  string
+	product  string
+	version  string
+	cpe      string
+	conf     int
+}
+
+// nmapPortState maps a ScanStatus to the nmap port state and reason. A UDP
+// probe that timed out or was closed without a reply may have been dropped
+// by a firewall as well as ignored by the service, so, as in nmap, the port
+// is open|filtered.
+func nmapPortState(status ScanStatus, protocol string) (state string, reason string) {
+	if protocol == "udp" && (status == SCAN_IO_TIMEOUT || status == SCAN_CONNECTION_CLOSED) {
+		return "open|filtered", "no-response"
+	}
+	switch status {
+	case SCAN_CONNECTION_REFUSED:
+		return "closed", "conn-refused"
+	case SCAN_CONNECTION_TIMEOUT, SCAN_UNKNOWN_ERROR, SCAN_DNS_NOT_FOUND, SCAN_DNS_ERROR:
+		return "filtered", "no-response"
+	case SCAN_HOST_UNREACHABLE:
+		return "filtered", "host-unreach"
+	case SCAN_NETWORK_UNREACHABLE:
+		return "filtered", "net-unreach"
+	default:
+		// Any other status means the module exchanged data with the service.
+		if protocol == "udp" {
+			return "open", "udp-response"
+		}
+		return "open", "syn-ack"
+	}
+}
+
+// nmapPorts merges the module responses in grab into one nmapPort per
+// protocol and port, in the order in which the scanners were registered.
+// The service of a port is taken from the first module that scanned it
+// successfully.
+func nmapPorts(grab *encodedGrab) []*nmapPort {
+	var names []string
+	for _, name := range orderedScanners {
+		if _, ok := grab.Data[name]; ok {
+			names = append(names, name)
+		}
+	}
+	var rest []string
+	for name := range grab.Data {
+		if scanners[name] == nil {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	names = append(names, rest...)
+
+	var ports []*nmapPort
+	byKey := make(map[string]*nmapPort)
+	for _, name := range names {
+		response := grab.Data[name]
+		port := grab.Port
+		if port == 0 {
+			if flags := getScanBaseFlags(name); flags != nil {
+				port = flags.Port
+			}
+		}
+		protocol := getScanTransport(name)
+		state, reason := nmapPortState(response.Status, protocol)
+		key := fmt.Sprintf("%s/%d", protocol, port)
+		p := byKey[key]
+		if p == nil {
+			p = &nmapPort{protocol: protocol, port: port, state: state, reason: reason}
+			byKey[key] = p
+			ports = append(ports, p)
+		} else if p.state != "open" && state == "open" {
+			p.state, p.reason = state, reason
+		}
+		if response.Status == SCAN_SUCCESS && p.service == "" {
+			p.service = response.Protocol
+			p.conf = 10
+			if info := response.Service; info != nil {
+				p.product, p.version, p.cpe = info.Product, info.Version, info.CPE
+				if info.Confidence > 0 {
+					p.conf = info.Confidence
+				}
+			} else {
+				p.product, p.version = resultProductVersion(response.Result)
+			}
+		}
+	}
+	return ports
+}
+
+// resultProductVersion returns the top-level product and version fields of
+// a module result, for modules that report them without implementing
+// ServiceIdentifier.
+func resultProductVersion(result json.RawMessage) (product string, version string) {
+	var fields struct {
+		Product string `json:"product"`
+		Version string `json:"version"`
+	}
+	if len(result) > 0 && json.Unmarshal(result, &fields) == nil {
+		return fields.Product, fields.Version
+	}
+	return "", ""
+}
+
+// hostUp is true if any port of the host answered.
+func hostUp(ports []*nmapPort) bool {
+	for _, p := range ports {
+		if p.state != "filtered" && p.state != "open|filtered" {
+			return true
+		}
+	}
+	return false
+}
+
+// nmapRun accumulates the run statistics written at the end of nmap output.
+type nmapRun struct {
+	start time.Time
+	up    int
+	down  int
+}
+
+func newNmapRun() *nmapRun {
+	return &nmapRun{start: time.Now()}
+}
+
+// decode parses an encoded Grab and counts the host as up or down.
+func (run *nmapRun) decode(result []byte) (*encodedGrab, []*nmapPort, error) {
+	var grab encodedGrab
+	if err := json.Unmarshal(result, &grab); err != nil {
+		return nil, nil, err
+	}
+	ports := nmapPorts(&grab)
+	if hostUp(ports) {
+		run.up++
+	} else {
+		run.down++
+	}
+	return &grab, ports, nil
+}
+
+// XML elements of an nmap -oX report.
+type nmapXMLHost struct {
+	XMLName   xml.Name          `xml:"host"`
+	Status    nmapXMLStatus     `xml:"status"`
+	Addresses []nmapXMLAddress  `xml:"address"`
+	Hostnames []nmapXMLHostname `xml:"hostnames>hostname,omitempty"`
+	Ports     []nmapXMLPort     `xml:"ports>port"`
+}
+
+type nmapXMLStatus struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+type nmapXMLAddress struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+}
+
+type nmapXMLHostname struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type nmapXMLPort struct {
+	Protocol string          `xml:"protocol,attr"`
+	PortID   uint            `xml:"portid,attr"`
+	State    nmapXMLStatus   `xml:"state"`
+	Service  *nmapXMLService `xml:"service,omitempty"`
+}
+
+type nmapXMLService struct {
+	Name    string `xml:"name,attr"`
+	Product string `xml:"product,attr,omitempty"`
+	Version string `xml:"version,attr,omitempty"`
+	Method  string `xml:"method,attr"`
+	Conf    int    `xml:"conf,attr"`
+	CPE     string `xml:"cpe,omitempty"`
+}
+
+func buildNmapXMLHost(grab *encodedGrab, ports []*nmapPort) *nmapXMLHost {
+	host := &nmapXMLHost{Status: nmapXMLStatus{State: "down", Reason: "no-response"}}
+	if hostUp(ports) {
+		host.Status = nmapXMLStatus{State: "up", Reason: "user-set"}
+	}
+	if grab.IP != "" {
+		addrType := "ipv4"
+		if strings.Contains(grab.IP, ":") {
+			addrType = "ipv6"
+		}
+		host.Addresses = append(host.Addresses, nmapXMLAddress{Addr: grab.IP, AddrType: addrType})
+	}
+	if grab.Domain != "" {
+		host.Hostnames = append(host.Hostnames, nmapXMLHostname{Name: grab.Domain, Type: "user"})
+	}
+	for _, p := range ports {
+		port := nmapXMLPort{
+			Protocol: p.protocol,
+			PortID:   p.port,
+			State:    nmapXMLStatus{State: p.state, Reason: p.reason},
+		}
+		if p.service != "" {
+			port.Service = &nmapXMLService{Name: p.service, Product: p.product, Version: p.version, Method: "probed", Conf: p.conf, CPE: p.cpe}
+		}
+		host.Ports = append(host.Ports, port)
+	}
+	return host
+}
+
+// OutputResultsNmapXMLFunc returns an OutputResultsFunc that renders each
+// result as a <host> element of an nmap XML report (as written by nmap -oX),
+// with one <port> per protocol and port scanned.
+func OutputResultsNmapXMLFunc(w io.Writer) OutputResultsFunc {
+	buf := bufio.NewWriter(w)
+	return func(results <-chan []byte) error {
+		defer buf.Flush()
+		run := newNmapRun()
+		fmt.Fprintf(buf, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!DOCTYPE nmaprun>\n")
+		fmt.Fprintf(buf, "<nmaprun scanner=\"zgrab2\" args=\"%s\" start=\"%d\" startstr=\"%s\" xmloutputversion=\"1.05\">\n",
+			xmlEscape(strings.Join(os.Args, " ")), run.start.Unix(), xmlEscape(run.start.Format(time.ANSIC)))
+		encoder := xml.NewEncoder(buf)
+		for result := range results {
+			grab, ports, err := run.decode(result)
+			if err != nil {
+				log.Errorf("unable to decode result, skipping: %s", err)
+				continue
+			}
+			if err := encoder.Encode(buildNmapXMLHost(grab, ports)); err != nil {
+				return err
+			}
+			if err := buf.WriteByte('\n'); err != nil {
+				return err
+			}
+			if config.Flush {
+				buf.Flush()
+			}
+		}
+		end := time.Now()
+		_, err := fmt.Fprintf(buf, "<runstats><finished time=\"%d\" timestr=\"%s\" elapsed=\"%.2f\" exit=\"success\"/><hosts up=\"%d\" down=\"%d\" total=\"%d\"/></runstats>\n</nmaprun>\n",
+			end.Unix(), xmlEscape(end.Format(time.ANSIC)), end.Sub(run.start).Seconds(), run.up, run.down, run.up+run.down)
+		return err
+	}
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// grepableField escapes a value for a slash-separated field of nmap
+// grepable output, as nmap does.
+func grepableField(s string) string {
+	return strings.Replace(s, "/", "|", -1)
+}
+
+// OutputResultsNmapGrepableFunc returns an OutputResultsFunc that renders
+// each result as a line of nmap grepable output (as written by nmap -oG).
+func OutputResultsNmapGrepableFunc(w io.Writer) OutputResultsFunc {
+	buf := bufio.NewWriter(w)
+	return func(results <-chan []byte) error {
+		defer buf.Flush()
+		run := newNmapRun()
+		fmt.Fprintf(buf, "# zgrab2 scan initiated %s as: %s\n", run.start.Format(time.ANSIC), strings.Join(os.Args, " "))
+		for result := range results {
+			grab, ports, err := run.decode(result)
+			if err != nil {
+				log.Errorf("unable to decode result, skipping: %s", err)
+				continue
+			}
+			host := grab.IP
+			if host == "" {
+				host = grab.Domain
+			}
+			host = fmt.Sprintf("Host: %s (%s)", host, grab.Domain)
+			if !hostUp(ports) {
+				fmt.Fprintf(buf, "%s\tStatus: Down\n", host)
+			} else {
+				fmt.Fprintf(buf, "%s\tStatus: Up\n", host)
+				items := make([]string, len(ports))
+				for i, p := range ports {
+					versionInfo := strings.TrimSpace(p.product + " " + p.version)
+					items[i] = fmt.Sprintf("%d/%s/%s//%s//%s/", p.port, p.state, p.protocol, grepableField(p.service), grepableField(versionInfo))
+				}
+				fmt.Fprintf(buf, "%s\tPorts: %s\n", host, strings.Join(items, ", "))
+			}
+			if config.Flush {
+				buf.Flush()
+			}
+		}
+		end := time.Now()
+		_, err := fmt.Fprintf(buf, "# zgrab2 done at %s -- %d IP addresses (%d hosts up) scanned in %.2f seconds\n",
+			end.Format(time.ANSIC), run.up+run.down, run.up, end.Sub(run.start).Seconds())
+		return err
+	}
+}
@@ -0,0 +1,125 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func runOutput(t *testing.T, f func(*bytes.Buffer) OutputResultsFunc, results ...string) string {
+	var buf bytes.Buffer
+	ch := make(chan []byte, len(results))
+	for _, r := range results {
+		ch <- []byte(r)
+	}
+	close(ch)
+	if err := f(&buf)(ch); err != nil {
+		t.Fatalf("output error: %v", err)
+	}
+	return buf.String()
+}
+
+var nmapTestResults = []string{
+	`{"ip":"10.0.0.1","domain":"example.com","port":6379,"data":{"redis":{"status":"success","protocol":"redis","result":{"version":"5.0.7"},"service":{"product":"Redis","version":"5.0.7","cpe":"cpe:2.3:a:redis:redis:5.0.7:*:*:*:*:*:*:*","confidence":10}},"banner":{"status":"protocol-error","protocol":"banner","result":{"banner":"-ERR"}}}}`,
+	`{"ip":"10.0.0.2","port":22,"data":{"ssh":{"status":"connection-refused","protocol":"ssh","error":"refused"}}}`,
+	`{"ip":"2001:db8::3","port":22,"data":{"ssh":{"status":"connection-timeout","protocol":"ssh","error":"timeout"}}}`,
+}
+
+func TestNmapPortState(t *testing.T) {
+	tests := []struct {
+		status   ScanStatus
+		protocol string
+		state    string
+		reason   string
+	}{
+		{SCAN_SUCCESS, "tcp", "open", "syn-ack"},
+		{SCAN_IO_TIMEOUT, "tcp", "open", "syn-ack"},
+		{SCAN_CONNECTION_REFUSED, "tcp", "closed", "conn-refused"},
+		{SCAN_CONNECTION_TIMEOUT, "tcp", "filtered", "no-response"},
+		{SCAN_SUCCESS, "udp", "open", "udp-response"},
+		{SCAN_PROTOCOL_ERROR, "udp", "open", "udp-response"},
+		{SCAN_IO_TIMEOUT, "udp", "open|filtered", "no-response"},
+		{SCAN_CONNECTION_CLOSED, "udp", "open|filtered", "no-response"},
+		{SCAN_CONNECTION_REFUSED, "udp", "closed", "conn-refused"},
+	}
+	for _, test := range tests {
+		if state, reason := nmapPortState(test.status, test.protocol); state != test.state || reason != test.reason {
+			t.Errorf("%s/%s: got %s %s, expected %s %s", test.protocol, test.status, state, reason, test.state, test.reason)
+		}
+	}
+}
+
+func TestOutputResultsNmapXML(t *testing.T) {
+	out := runOutput(t, func(b *bytes.Buffer) OutputResultsFunc { return OutputResultsNmapXMLFunc(b) }, nmapTestResults...)
+
+	var report struct {
+		Hosts []struct {
+			Status    nmapXMLStatus     `xml:"status"`
+			Addresses []nmapXMLAddress  `xml:"address"`
+			Hostnames []nmapXMLHostname `xml:"hostnames>hostname"`
+			Ports     []struct {
+				Protocol string          `xml:"protocol,attr"`
+				PortID   uint            `xml:"portid,attr"`
+				State    nmapXMLStatus   `xml:"state"`
+				Service  *nmapXMLService `xml:"service"`
+			} `xml:"ports>port"`
+		} `xml:"host"`
+		Stats struct {
+			Up    int `xml:"up,attr"`
+			Down  int `xml:"down,attr"`
+			Total int `xml:"total,attr"`
+		} `xml:"runstats>hosts"`
+	}
+	if err := xml.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, out)
+	}
+	if len(report.Hosts) != 3 {
+		t.Fatalf("wrong number of hosts (got %d; expected 3)", len(report.Hosts))
+	}
+	host := report.Hosts[0]
+	if host.Status.State != "up" || host.Addresses[0].Addr != "10.0.0.1" || host.Addresses[0].AddrType != "ipv4" || host.Hostnames[0].Name != "example.com" {
+		t.Errorf("wrong host: %+v", host)
+	}
+	if len(host.Ports) != 1 {
+		t.Fatalf("responses for the same port were not merged: %+v", host.Ports)
+	}
+	port := host.Ports[0]
+	if port.Protocol != "tcp" || port.PortID != 6379 || port.State.State != "open" || port.Service == nil ||
+		port.Service.Name != "redis" || port.Service.Product != "Redis" || port.Service.Version != "5.0.7" ||
+		port.Service.CPE != "cpe:2.3:a:redis:redis:5.0.7:*:*:*:*:*:*:*" {
+		t.Errorf("wrong port: %+v %+v", port, port.Service)
+	}
+	if state := report.Hosts[1].Ports[0].State.State; state != "closed" || report.Hosts[1].Status.State != "up" {
+		t.Errorf("wrong state for refused port: %s", state)
+	}
+	if state := report.Hosts[2].Ports[0].State.State; state != "filtered" || report.Hosts[2].Status.State != "down" || report.Hosts[2].Addresses[0].AddrType != "ipv6" {
+		t.Errorf("wrong state for timed out port: %s", state)
+	}
+	if report.Stats.Up != 2 || report.Stats.Down != 1 || report.Stats.Total != 3 {
+		t.Errorf("wrong run stats: %+v", report.Stats)
+	}
+}
+
+func TestOutputResultsNmapGrepable(t *testing.T) {
+	out := runOutput(t, func(b *bytes.Buffer) OutputResultsFunc { return OutputResultsNmapGrepableFunc(b) }, nmapTestResults...)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	expected := []string{
+		"Host: 10.0.0.1 (example.com)\tStatus: Up",
+		"Host: 10.0.0.1 (example.com)\tPorts: 6379/open/tcp//redis//Redis 5.0.7/",
+		"Host: 10.0.0.2 ()\tStatus: Up",
+		"Host: 10.0.0.2 ()\tPorts: 22/closed/tcp/////",
+		"Host: 2001:db8::3 ()\tStatus: Down",
+	}
+	if len(lines) != len(expected)+2 {
+		t.Fatalf("wrong number of lines (got %d; expected %d):\n%s", len(lines), len(expected)+2, out)
+	}
+	if !strings.HasPrefix(lines[0], "# zgrab2 scan initiated") || !strings.Contains(lines[len(lines)-1], "3 IP addresses (2 hosts up)") {
+		t.Errorf("wrong header or trailer:\n%s", out)
+	}
+	for i, line := range expected {
+		if lines[i+1] != line {
+			t.Errorf("wrong line %d (got %q; expected %q)", i+1, lines[i+1], line)
+		}
+	}
+}
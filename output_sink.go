@@ -0,0 +1,356 @@
+package zgrab2
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// FormatFileName replaces instances in format of {TIMESTAMP} with when
+// formatted as YYYYMMDDhhmmss, and {NANOS} as the decimal nanosecond offset.
+func FormatFileName(format string, when time.Time) string {
+	timestamp := when.Format("20060102150405")
+	nanos := fmt.Sprintf("%d", when.Nanosecond())
+	ret := strings.Replace(format, "{TIMESTAMP}", timestamp, -1)
+	ret = strings.Replace(ret, "{NANOS}", nanos, -1)
+	return ret
+}
+
+// isCompressedName reports whether the output file name calls for
+// compression, by its extension.
+func isCompressedName(name string) bool {
+	for _, ext := range []string{".gz", ".zst", ".zstd"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// newCompressor returns a writer compressing to w as the extension of name
+// calls for (.gz for gzip, .zst or .zstd for zstd), or nil if it calls for
+// none.
+func newCompressor(name string, w io.Writer) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return gzip.NewWriter(w), nil
+	case strings.HasSuffix(name, ".zst"), strings.HasSuffix(name, ".zstd"):
+		return zstd.NewWriter(w)
+	}
+	return nil, nil
+}
+
+// flusher is implemented by the compressors.
+type flusher interface {
+	Flush() error
+}
+
+// closingOutputFunc returns an OutputResultsFunc that runs f, then closes c.
+// The nmap output formats use it to finish their compressed output.
+func closingOutputFunc(f OutputResultsFunc, c io.Closer) OutputResultsFunc {
+	return func(results <-chan []byte) error {
+		err := f(results)
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// sinkFile is one of the files an outputSink writes to.
+type sinkFile struct {
+	file       *os.File
+	compressor io.WriteCloser
+	counter    *countingWriter
+	buf        *bufio.Writer
+	records    int64
+	opened     time.Time
+}
+
+// openSinkFile creates the file name, or appends to it if append is set.
+func openSinkFile(name string, append bool, now time.Time) (*sinkFile, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(name, flags, 0666)
+	if err != nil {
+		return nil, err
+	}
+	ret := &sinkFile{file: file, counter: &countingWriter{w: file}, opened: now}
+	var w io.Writer = ret.counter
+	if ret.compressor, err = newCompressor(name, ret.counter); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if ret.compressor != nil {
+		w = ret.compressor
+	}
+	ret.buf = bufio.NewWriter(w)
+	return ret, nil
+}
+
+func (f *sinkFile) write(record []byte) error {
+	if _, err := f.buf.Write(record); err != nil {
+		return err
+	}
+	if err := f.buf.WriteByte('\n'); err != nil {
+		return err
+	}
+	f.records++
+	if config.Flush {
+		return f.flush()
+	}
+	return nil
+}
+
+func (f *sinkFile) flush() error {
+	if err := f.buf.Flush(); err != nil {
+		return err
+	}
+	if c, ok := f.compressor.(flusher); ok {
+		return c.Flush()
+	}
+	return nil
+}
+
+// size returns the number of bytes written to the file, counting those
+// still buffered. Compressed output is only counted once the compressor
+// emits it, so compressed files run over the limit by up to a block.
+func (f *sinkFile) size() int64 {
+	if f.compressor != nil {
+		return f.counter.n
+	}
+	return f.counter.n + int64(f.buf.Buffered())
+}
+
+func (f *sinkFile) close() error {
+	err := f.buf.Flush()
+	if f.compressor != nil {
+		if closeErr := f.compressor.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sinkStream is the sequence of files for one module (or for all of them,
+// unless the output is split by module).
+type sinkStream struct {
+	index int
+	file  *sinkFile
+}
+
+// outputSink writes the results to files named after a template, which may
+// compress them, rotate them, and split them by module.
+type outputSink struct {
+	// template is the file name, in which {MODULE} is replaced by the module
+	// and {INDEX} by the number of the file in its stream, counting from 0,
+	// before FormatFileName is applied.
+	template string
+
+	// A new file is started once the current one reaches rotateBytes (on
+	// disk) or rotateRecords, or was opened rotateInterval ago. Zero
+	// disables each limit.
+	rotateBytes    int64
+	rotateRecords  int64
+	rotateInterval time.Duration
+
+	// split writes each module's responses to a separate stream.
+	split   bool
+	streams map[string]*sinkStream
+	// used are the names of the files opened so far. Since every rotated
+	// name has an {INDEX}, a name only comes up again for modules whose
+	// names differ only by a path separator, which then share the file.
+	used map[string]bool
+}
+
+// insertPlaceholders adds the placeholders to the name of a file, before
+// its extensions: out.json.gz becomes out.{MODULE}.json.gz.
+func insertPlaceholders(name string, placeholders []string) string {
+	if len(placeholders) == 0 {
+		return name
+	}
+	dir, base := filepath.Split(name)
+	inserted := strings.Join(placeholders, ".")
+	if i := strings.Index(base, "."); i > 0 {
+		return dir + base[:i] + "." + inserted + base[i:]
+	}
+	return dir + base + "." + inserted
+}
+
+// newOutputSink returns an outputSink writing to files named after name. A
+// {MODULE} placeholder is added to the name when splitting, and an {INDEX}
+// placeholder when rotating without one, since a {TIMESTAMP} may not change
+// between files. The first file is opened at once unless the output is
+// split.
+func newOutputSink(name string, rotateBytes, rotateRecords int64, rotateInterval time.Duration, split bool) (*outputSink, error) {
+	var placeholders []string
+	if split && !strings.Contains(name, "{MODULE}") {
+		placeholders = append(placeholders, "{MODULE}")
+	}
+	rotating := rotateBytes > 0 || rotateRecords > 0 || rotateInterval > 0
+	if rotating && !strings.Contains(name, "{INDEX}") {
+		placeholders = append(placeholders, "{INDEX}")
+	}
+	ret := &outputSink{
+		template:       insertPlaceholders(name, placeholders),
+		rotateBytes:    rotateBytes,
+		rotateRecords:  rotateRecords,
+		rotateInterval: rotateInterval,
+		split:          split,
+		streams:        make(map[string]*sinkStream),
+		used:           make(map[string]bool),
+	}
+	if !split {
+		if _, err := ret.fileFor("", time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// full reports whether f has reached one of the rotation limits.
+func (s *outputSink) full(f *sinkFile, now time.Time) bool {
+	return (s.rotateRecords > 0 && f.records >= s.rotateRecords) ||
+		(s.rotateBytes > 0 && f.size() >= s.rotateBytes) ||
+		(s.rotateInterval > 0 && now.Sub(f.opened) >= s.rotateInterval)
+}
+
+// fileFor returns the file to write the next result of module to, starting
+// a new one if the current file is full.
+func (s *outputSink) fileFor(module string, now time.Time) (*sinkFile, error) {
+	stream := s.streams[module]
+	if stream == nil {
+		stream = &sinkStream{}
+		s.streams[module] = stream
+	}
+	if stream.file != nil {
+		if !s.full(stream.file, now) {
+			return stream.file, nil
+		}
+		err := stream.file.close()
+		stream.file = nil
+		stream.index++
+		if err != nil {
+			return nil, err
+		}
+	}
+	name := strings.Replace(s.template, "{MODULE}", strings.Replace(module, string(os.PathSeparator), "_", -1), -1)
+	name = strings.Replace(name, "{INDEX}", strconv.Itoa(stream.index), -1)
+	name = FormatFileName(name, now)
+	file, err := openSinkFile(name, s.used[name], now)
+	if err != nil {
+		return nil, err
+	}
+	s.used[name] = true
+	stream.file = file
+	return file, nil
+}
+
+// write writes a result to the files it belongs in. When splitting, each
+// module's file gets a copy of the result with only that module's
+// response; a result without any (after a failed DNS lookup, for
+// instance) goes to the file of every module.
+func (s *outputSink) write(result []byte) error {
+	now := time.Now()
+	if !s.split {
+		f, err := s.fileFor("", now)
+		if err != nil {
+			return err
+		}
+		return f.write(result)
+	}
+	// Only the data is split; the other fields of the Grab are copied as
+	// they are.
+	var grab map[string]json.RawMessage
+	if err := json.Unmarshal(result, &grab); err != nil {
+		return err
+	}
+	var data map[string]json.RawMessage
+	if raw, ok := grab["data"]; ok {
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return err
+		}
+	}
+	modules := make([]string, 0, len(data))
+	for module := range data {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	if len(modules) == 0 {
+		modules = orderedScanners
+	}
+	for _, module := range modules {
+		record := result
+		if len(data) > 0 {
+			moduleData, err := json.Marshal(map[string]json.RawMessage{module: data[module]})
+			if err != nil {
+				return err
+			}
+			grab["data"] = moduleData
+			if record, err = json.Marshal(grab); err != nil {
+				return err
+			}
+		}
+		f, err := s.fileFor(module, now)
+		if err != nil {
+			return err
+		}
+		if err := f.write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close closes every file.
+func (s *outputSink) close() error {
+	var err error
+	for _, stream := range s.streams {
+		if stream.file == nil {
+			continue
+		}
+		if closeErr := stream.file.close(); err == nil {
+			err = closeErr
+		}
+		stream.file = nil
+	}
+	return err
+}
+
+// output is the OutputResultsFunc of the sink.
+func (s *outputSink) output(results <-chan []byte) error {
+	for result := range results {
+		if err := s.write(result); err != nil {
+			s.close()
+			return err
+		}
+	}
+	return s.close()
+}
@@ -0,0 +1,178 @@
+package zgrab2
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestFormatFileName(t *testing.T) {
+	when := time.Date(2021, 2, 3, 4, 5, 6, 7, time.UTC)
+	if name := FormatFileName("out-{TIMESTAMP}-{NANOS}.json", when); name != "out-20210203040506-7.json" {
+		t.Errorf("got %s", name)
+	}
+}
+
+func TestInsertPlaceholders(t *testing.T) {
+	tests := []struct {
+		name         string
+		placeholders []string
+		expected     string
+	}{
+		{"out.json", nil, "out.json"},
+		{"out.json.gz", []string{"{MODULE}"}, "out.{MODULE}.json.gz"},
+		{"dir.d/out", []string{"{MODULE}", "{INDEX}"}, "dir.d/out.{MODULE}.{INDEX}"},
+		{"dir/.out.json", []string{"{INDEX}"}, "dir/.out.json.{INDEX}"},
+	}
+	for _, test := range tests {
+		if name := insertPlaceholders(test.name, test.placeholders); name != test.expected {
+			t.Errorf("%s: got %s, expected %s", test.name, name, test.expected)
+		}
+	}
+}
+
+// writeSink sends the results through a new outputSink.
+func writeSink(t *testing.T, name string, rotateBytes, rotateRecords int64, split bool, results ...string) {
+	sink, err := newOutputSink(name, rotateBytes, rotateRecords, 0, split)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan []byte, len(results))
+	for _, result := range results {
+		ch <- []byte(result)
+	}
+	close(ch)
+	if err := sink.output(ch); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readLines returns the lines of the file name, decompressing it as its
+// extension calls for.
+func readLines(t *testing.T, name string) []string {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	switch filepath.Ext(name) {
+	case ".gz":
+		if r, err = gzip.NewReader(f); err != nil {
+			t.Fatal(err)
+		}
+	case ".zst":
+		d, err := zstd.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer d.Close()
+		r = d
+	}
+	var ret []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		ret = append(ret, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+// listDir returns the names of the files in dir.
+func listDir(t *testing.T, dir string) []string {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret []string
+	for _, entry := range entries {
+		ret = append(ret, entry.Name())
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestOutputSinkCompression(t *testing.T) {
+	for _, ext := range []string{".json", ".json.gz", ".json.zst"} {
+		name := filepath.Join(t.TempDir(), "out"+ext)
+		writeSink(t, name, 0, 0, false, `{"ip":"192.0.2.1"}`, `{"ip":"192.0.2.2"}`)
+		lines := readLines(t, name)
+		if strings.Join(lines, ",") != `{"ip":"192.0.2.1"},{"ip":"192.0.2.2"}` {
+			t.Errorf("%s: got %v", ext, lines)
+		}
+	}
+}
+
+func TestOutputSinkRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeSink(t, filepath.Join(dir, "out.json.gz"), 0, 2, false, `{"port":1}`, `{"port":2}`, `{"port":3}`)
+	if files := listDir(t, dir); strings.Join(files, ",") != "out.0.json.gz,out.1.json.gz" {
+		t.Fatalf("got files %v", files)
+	}
+	if lines := readLines(t, filepath.Join(dir, "out.1.json.gz")); len(lines) != 1 || lines[0] != `{"port":3}` {
+		t.Errorf("got %v", lines)
+	}
+
+	dir = t.TempDir()
+	writeSink(t, filepath.Join(dir, "out-{INDEX}.json"), 10, 0, false, `{"port":10}`, `{"port":20}`, `{"port":3}`)
+	if files := listDir(t, dir); strings.Join(files, ",") != "out-0.json,out-1.json,out-2.json" {
+		t.Errorf("got files %v", files)
+	}
+
+	// Files rotated within the same second are not appended to.
+	dir = t.TempDir()
+	writeSink(t, filepath.Join(dir, "out-{TIMESTAMP}.json"), 0, 1, false, `{"port":1}`, `{"port":2}`, `{"port":3}`)
+	files := listDir(t, dir)
+	if len(files) != 3 {
+		t.Fatalf("got files %v", files)
+	}
+	for _, file := range files {
+		if lines := readLines(t, filepath.Join(dir, file)); len(lines) != 1 {
+			t.Errorf("%s: got %v", file, lines)
+		}
+	}
+}
+
+func TestOutputSinkSplit(t *testing.T) {
+	defer func(saved []string) {
+		orderedScanners = saved
+	}(orderedScanners)
+	orderedScanners = []string{"http", "ssh"}
+	dir := t.TempDir()
+	writeSink(t, filepath.Join(dir, "out.json"), 0, 0, true,
+		`{"ip":"192.0.2.1","extra":[1],"data":{"ssh":{"status":"success"},"http":{"status":"connection-refused"}}}`,
+		`{"domain":"example.invalid"}`)
+	if files := listDir(t, dir); strings.Join(files, ",") != "out.http.json,out.ssh.json" {
+		t.Fatalf("got files %v", files)
+	}
+	lines := readLines(t, filepath.Join(dir, "out.ssh.json"))
+	if len(lines) != 2 {
+		t.Fatalf("got %v", lines)
+	}
+	var grab struct {
+		IP    string                     `json:"ip"`
+		Extra []int                      `json:"extra"`
+		Data  map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &grab); err != nil {
+		t.Fatal(err)
+	}
+	if grab.IP != "192.0.2.1" || len(grab.Extra) != 1 || len(grab.Data) != 1 || grab.Data["ssh"] == nil {
+		t.Errorf("got %s", lines[0])
+	}
+	if lines[1] != `{"domain":"example.invalid"}` {
+		t.Errorf("got %s", lines[1])
+	}
+}
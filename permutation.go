@@ -0,0 +1,119 @@
+package zgrab2
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"math/rand"
+)
+
+// This file implements the address permutation used by --randomize. As in
+// ZMap, the targets of a block are numbered 0 to n-1, and visited in the
+// order of the powers of a generator g of the multiplicative group of
+// integers modulo a prime p > n, starting from a random element. Elements
+// above n are skipped. Only p, g and the current element are kept, so the
+// block is never held in memory.
+
+// GetRandomizeSeed returns the seed used to order the targets, or nil if
+// --randomize is not set.
+func GetRandomizeSeed() *int64 {
+	if !config.Randomize {
+		return nil
+	}
+	seed := config.Seed
+	return &seed
+}
+
+// maxPermutationSize is the largest block that can be permuted, leaving
+// room for a prime above it in a uint64.
+const maxPermutationSize = 1 << 62
+
+// cyclicPermutation is a pseudo-random permutation of 0, ..., n-1.
+type cyclicPermutation struct {
+	n     uint64
+	p     uint64
+	g     uint64
+	start uint64
+}
+
+// newCyclicPermutation returns a permutation of 0, ..., n-1, chosen by the
+// seed.
+func newCyclicPermutation(n uint64, seed int64) (*cyclicPermutation, error) {
+	if n > maxPermutationSize {
+		return nil, fmt.Errorf("cannot permute %d targets (the maximum is %d)", n, uint64(maxPermutationSize))
+	}
+	ret := &cyclicPermutation{n: n}
+	if n < 2 {
+		return ret, nil
+	}
+	// With a safe prime p = 2q + 1, the only prime factors of the group
+	// order p - 1 are 2 and q, so a generator is easy to recognize.
+	ret.p = nextSafePrime(n + 1)
+	q := (ret.p - 1) / 2
+	random := rand.New(rand.NewSource(seed))
+	for {
+		ret.g = 2 + uint64(random.Int63n(int64(ret.p-3)))
+		if powMod(ret.g, 2, ret.p) != 1 && powMod(ret.g, q, ret.p) != 1 {
+			break
+		}
+	}
+	ret.start = 1 + uint64(random.Int63n(int64(ret.p-1)))
+	return ret, nil
+}
+
+// each calls f with every number from 0 to n-1, in the permuted order.
+func (c *cyclicPermutation) each(f func(uint64)) {
+	if c.n < 2 {
+		for i := uint64(0); i < c.n; i++ {
+			f(i)
+		}
+		return
+	}
+	x := c.start
+	for {
+		if x <= c.n {
+			f(x - 1)
+		}
+		if x = mulMod(x, c.g, c.p); x == c.start {
+			return
+		}
+	}
+}
+
+// nextSafePrime returns a prime p >= n such that (p - 1) / 2 is also prime.
+// It is the smallest such prime above 7.
+func nextSafePrime(n uint64) uint64 {
+	if n < 5 {
+		n = 5
+	}
+	// Safe primes above 7 are 11 mod 12.
+	p := n + (11+12-n%12)%12
+	for ; ; p += 12 {
+		if isPrime(p) && isPrime((p-1)/2) {
+			return p
+		}
+	}
+}
+
+func isPrime(n uint64) bool {
+	return new(big.Int).SetUint64(n).ProbablyPrime(20)
+}
+
+// mulMod returns a * b mod m, for a, b < m.
+func mulMod(a, b, m uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	_, rem := bits.Div64(hi, lo, m)
+	return rem
+}
+
+// powMod returns b^e mod m, for b < m.
+func powMod(b, e, m uint64) uint64 {
+	ret := uint64(1)
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			ret = mulMod(ret, b, m)
+		}
+		b = mulMod(b, b, m)
+	}
+	return ret
+}
@@ -0,0 +1,104 @@
+package zgrab2
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCyclicPermutation(t *testing.T) {
+	for _, n := range []uint64{0, 1, 2, 3, 7, 10, 256, 1000, 65536} {
+		perm, err := newCyclicPermutation(n, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen := make([]bool, n)
+		count := uint64(0)
+		perm.each(func(i uint64) {
+			if i >= n || seen[i] {
+				t.Fatalf("n=%d: %d out of range or repeated", n, i)
+			}
+			seen[i] = true
+			count++
+		})
+		if count != n {
+			t.Errorf("n=%d: visited %d elements", n, count)
+		}
+	}
+	if _, err := newCyclicPermutation(maxPermutationSize+1, 42); err == nil {
+		t.Error("expected an error for a block that is too large")
+	}
+}
+
+func permutationOrder(n uint64, seed int64) []uint64 {
+	perm, _ := newCyclicPermutation(n, seed)
+	var ret []uint64
+	perm.each(func(i uint64) {
+		ret = append(ret, i)
+	})
+	return ret
+}
+
+func TestCyclicPermutationSeed(t *testing.T) {
+	a, b := permutationOrder(1000, 1), permutationOrder(1000, 1)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("the same seed gave different orders")
+	}
+	if c := permutationOrder(1000, 2); reflect.DeepEqual(a, c) {
+		t.Error("different seeds gave the same order")
+	}
+	sequential := true
+	for i, v := range a {
+		if uint64(i) != v {
+			sequential = false
+		}
+	}
+	if sequential {
+		t.Error("the permutation is the identity")
+	}
+}
+
+func TestNextSafePrime(t *testing.T) {
+	for _, n := range []uint64{2, 12, 100, 1 << 32, maxPermutationSize} {
+		p := nextSafePrime(n)
+		if p < n || !isPrime(p) || !isPrime((p-1)/2) {
+			t.Errorf("nextSafePrime(%d) = %d", n, p)
+		}
+	}
+}
+
+func TestEmitPermutedTargets(t *testing.T) {
+	defer func(randomize bool, seed int64) {
+		config.Randomize, config.Seed = randomize, seed
+	}(config.Randomize, config.Seed)
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/28")
+	ports := PortList{{First: 80, Last: 80}, {First: 8000, Last: 8002}}
+
+	collect := func() []string {
+		ch := make(chan ScanTarget, 64)
+		emitTargets(ipnet, ports, ScanTarget{}, ch)
+		close(ch)
+		var ret []string
+		for target := range ch {
+			ret = append(ret, target.String())
+		}
+		return ret
+	}
+	config.Randomize = false
+	sequential := collect()
+	config.Randomize, config.Seed = true, 7
+	randomized := collect()
+	if reflect.DeepEqual(sequential, randomized) {
+		t.Error("--randomize did not change the order")
+	}
+	sort.Strings(sequential)
+	sort.Strings(randomized)
+	if len(sequential) != 64 || !reflect.DeepEqual(sequential, randomized) {
+		t.Errorf("--randomize changed the targets: %v", randomized)
+	}
+
+	if ip := addToIP(net.ParseIP("10.0.0.250").To4(), 10); ip.String() != "10.0.1.4" {
+		t.Errorf("wrong address: %s", ip)
+	}
+}
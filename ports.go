@@ -0,0 +1,90 @@
+package zgrab2
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of ports, First through Last.
+type PortRange struct {
+	First uint16
+	Last  uint16
+}
+
+// PortList is an ordered list of port ranges, as parsed by ParsePortList.
+// Ports are visited in the order they were given; duplicates are not removed.
+type PortList []PortRange
+
+// ParsePortList parses a comma-separated list of ports and port ranges, for
+// example "80,443,8000-8100".
+func ParsePortList(s string) (PortList, error) {
+	var ret PortList
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			return nil, fmt.Errorf("empty port in list %q", s)
+		}
+		first, last := item, item
+		if i := strings.Index(item, "-"); i >= 0 {
+			first, last = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		}
+		lo, err := parsePort(first)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := parsePort(last)
+		if err != nil {
+			return nil, err
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("invalid port range %q", item)
+		}
+		ret = append(ret, PortRange{First: lo, Last: hi})
+	}
+	return ret, nil
+}
+
+func parsePort(s string) (uint16, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse %q as a port", s)
+	}
+	if port == 0 {
+		return 0, fmt.Errorf("invalid port 0")
+	}
+	return uint16(port), nil
+}
+
+// Len returns the total number of ports in the list.
+func (l PortList) Len() int {
+	n := 0
+	for _, r := range l {
+		n += int(r.Last) - int(r.First) + 1
+	}
+	return n
+}
+
+// Ports returns every port in the list, expanding the ranges.
+func (l PortList) Ports() []uint {
+	ret := make([]uint, 0, l.Len())
+	for _, r := range l {
+		for port := uint(r.First); port <= uint(r.Last); port++ {
+			ret = append(ret, port)
+		}
+	}
+	return ret
+}
+
+// String formats the list in the syntax accepted by ParsePortList.
+func (l PortList) String() string {
+	items := make([]string, len(l))
+	for i, r := range l {
+		if r.First == r.Last {
+			items[i] = strconv.Itoa(int(r.First))
+		} else {
+			items[i] = fmt.Sprintf("%d-%d", r.First, r.Last)
+		}
+	}
+	return strings.Join(items, ",")
+}
@@ -1,10 +1,13 @@
 package zgrab2
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zmap/zgrab2/lib/output"
@@ -12,9 +15,12 @@ import (
 
 // Grab contains all scan responses for a single host
 type Grab struct {
-	IP     string                  `json:"ip,omitempty"`
-	Domain string                  `json:"domain,omitempty"`
-	Data   map[string]ScanResponse `json:"data,omitempty"`
+	IP         string                  `json:"ip,omitempty"`
+	Domain     string                  `json:"domain,omitempty"`
+	Port       uint                    `json:"port,omitempty"`
+	Metadata   json.RawMessage         `json:"metadata,omitempty"`
+	Resolution *Resolution             `json:"resolution,omitempty"`
+	Data       map[string]ScanResponse `json:"data,omitempty"`
 }
 
 // ScanTarget is the host that will be scanned
@@ -23,6 +29,33 @@ type ScanTarget struct {
 	Domain string
 	Tag    string
 	Port   *uint
+
+	// Metadata is an opaque JSON value supplied with the target in the
+	// input, which is copied verbatim into the output Grab.
+	Metadata json.RawMessage
+
+	// index numbers the target in input order, for checkpointing.
+	index uint64
+
+	// resolution is the DNS lookup that gave the IP, with --resolve.
+	resolution *Resolution
+
+	// source is the local address the target is scanned from, with
+	// --source-ip.
+	source net.IP
+
+	// trace collects the connections made by the scan in progress.
+	trace *scanTrace
+
+	// transport is the protocol of the port ("tcp" or "udp") when the input
+	// gives one, as imported port scans do. Only the scanners using that
+	// protocol are run against the target.
+	transport string
+
+	// service is the name of the service an imported port scan found on the
+	// port, if any. It is a hint for triggers, and does not stop the
+	// scanners without a trigger from running.
+	service string
 }
 
 func (target ScanTarget) String() string {
@@ -37,12 +70,31 @@ func (target ScanTarget) String() string {
 	} else {
 		res = target.Domain
 	}
+	if target.Port != nil {
+		res += fmt.Sprintf(" port:%d", *target.Port)
+	}
 	if target.Tag != "" {
 		res += " tag:" + target.Tag
 	}
+	if target.service != "" {
+		res += " service:" + target.service
+	}
 	return res
 }
 
+// triggers reports whether the scanners with the given trigger are run
+// against the target: those whose trigger is its tag, or, for a target
+// imported from a port scan, the name of the service found on its port.
+func (target *ScanTarget) triggers(trigger string) bool {
+	return target.Tag == trigger || (target.service != "" && target.service == trigger)
+}
+
+// SourceIP returns the local address the target is scanned from, or nil if
+// it is left to the operating system (see --source-ip).
+func (target *ScanTarget) SourceIP() net.IP {
+	return target.source
+}
+
 // Host gets the host identifier as a string: the IP address if it is available,
 // or the domain if not.
 func (target *ScanTarget) Host() string {
@@ -66,7 +118,12 @@ func (target *ScanTarget) Open(flags *BaseFlags) (net.Conn, error) {
 	}
 
 	address := net.JoinHostPort(target.Host(), fmt.Sprintf("%d", port))
-	return DialTimeoutConnection("tcp", address, flags.Timeout, flags.BytesReadLimit)
+	conn, err := dialTimeoutConnectionFrom(target.source, "tcp", address, flags.GetConnectTimeout(), flags.GetSessionTimeout(), flags.GetReadTimeout(), flags.GetWriteTimeout(), flags.BytesReadLimit)
+	if err != nil {
+		return nil, err
+	}
+	target.TrackConnection(conn)
+	return conn, nil
 }
 
 // OpenTLS connects to the ScanTarget using the configured flags, then performs
@@ -102,29 +159,62 @@ func (target *ScanTarget) OpenUDP(flags *BaseFlags, udp *UDPFlags) (net.Conn, er
 			local.Port = int(udp.LocalPort)
 		}
 	}
-	remote, err := net.ResolveUDPAddr("udp", address)
+	if target.source != nil && (local == nil || local.IP == nil) {
+		// --local-addr takes precedence over --source-ip
+		if local == nil {
+			local = &net.UDPAddr{}
+		}
+		local.IP = target.source
+	}
+	release, err := acquireDialSlots(context.Background(), address)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := net.DialUDP("udp", local, remote)
+	waitToConnect(context.Background())
+	start := time.Now()
+	var conn net.Conn
+	if len(proxies) > 0 {
+		conn, err = dialNetwork(context.Background(), &net.Dialer{Timeout: flags.GetConnectTimeout()}, "udp", address)
+	} else {
+		var remote *net.UDPAddr
+		if remote, err = net.ResolveUDPAddr("udp", address); err == nil {
+			if !targetFilter.allows(remote.IP) {
+				err = &net.OpError{Op: "dial", Net: "udp", Addr: remote, Err: ErrAddressExcluded}
+			} else {
+				conn, err = net.DialUDP("udp", local, remote)
+			}
+		}
+	}
 	if err != nil {
+		release()
 		return nil, err
 	}
-	return NewTimeoutConnection(nil, conn, flags.Timeout, 0, 0, flags.BytesReadLimit), nil
+	ret := NewTimeoutConnection(nil, conn, flags.GetSessionTimeout(), flags.GetReadTimeout(), flags.GetWriteTimeout(), flags.BytesReadLimit)
+	ret.dialDuration = ret.connected.Sub(start)
+	ret.releaseOnClose(release)
+	target.TrackConnection(ret)
+	return ret, nil
 }
 
 // BuildGrabFromInputResponse constructs a Grab object for a target, given the
 // scan responses.
 func BuildGrabFromInputResponse(t *ScanTarget, responses map[string]ScanResponse) *Grab {
 	var ipstr string
+	var port uint
 
 	if t.IP != nil {
 		ipstr = t.IP.String()
 	}
+	if t.Port != nil {
+		port = *t.Port
+	}
 	return &Grab{
-		IP:     ipstr,
-		Domain: t.Domain,
-		Data:   responses,
+		IP:         ipstr,
+		Domain:     t.Domain,
+		Port:       port,
+		Metadata:   t.Metadata,
+		Resolution: t.resolution,
+		Data:       responses,
 	}
 }
 
@@ -152,10 +242,23 @@ func EncodeGrab(raw *Grab, includeDebug bool) ([]byte, error) {
 func grabTarget(input ScanTarget, m *Monitor) []byte {
 	moduleResult := make(map[string]ScanResponse)
 
+	if input.IP != nil || input.Domain != "" {
+		input.source = sources.pick(input.Host())
+	}
 	for _, scannerName := range orderedScanners {
+		if input.resolution != nil && input.resolution.Error != "" {
+			// the output records the DNS error instead
+			break
+		}
 		scanner := scanners[scannerName]
 		trigger := (*scanner).GetTrigger()
-		if input.Tag != trigger {
+		if !input.triggers(trigger) {
+			continue
+		}
+		if dispatch != nil && input.Port != nil && !dispatch.allows(scannerName, *input.Port) {
+			continue
+		}
+		if input.transport != "" && getScanTransport(scannerName) != input.transport {
 			continue
 		}
 		defer func(name string) {
@@ -165,7 +268,7 @@ func grabTarget(input ScanTarget, m *Monitor) []byte {
 				panic(e)
 			}
 		}(scannerName)
-		name, res := RunScanner(*scanner, m, input)
+		name, res := runScanner(*scanner, getScanBaseFlags(scannerName), m, input)
 		moduleResult[name] = res
 		if res.Error != nil && !config.Multiple.ContinueOnError {
 			break
@@ -187,8 +290,19 @@ func grabTarget(input ScanTarget, m *Monitor) []byte {
 // Process sets up an output encoder, input reader, and starts grab workers.
 func Process(mon *Monitor) {
 	workers := config.Senders
+	if config.Dispatch {
+		dispatch = NewDispatchTable()
+		if err := dispatch.Apply(config.dispatchOverrides); err != nil {
+			log.Fatal(err)
+		}
+	}
 	processQueue := make(chan ScanTarget, workers*4)
+	resultQueue := make(chan trackedResult, workers*4)
 	outputQueue := make(chan []byte, workers*4)
+	if progress != nil {
+		// The progress tracker must know which results have been written.
+		outputQueue = make(chan []byte)
+	}
 
 	//Create wait groups
 	var workerDone sync.WaitGroup
@@ -196,7 +310,11 @@ func Process(mon *Monitor) {
 	workerDone.Add(int(workers))
 	outputDone.Add(1)
 
-	// Start the output encoder
+	// Start the output encoder. Results pass through forwardResults, so
+	// that the output can be closed and flushed without waiting for grabs
+	// that outlast the grace period after an interrupt.
+	stopResults := make(chan struct{})
+	go forwardResults(resultQueue, outputQueue, stopResults)
 	go func() {
 		defer outputDone.Done()
 		if err := config.outputResults(outputQueue); err != nil {
@@ -211,20 +329,111 @@ func Process(mon *Monitor) {
 				scanner.InitPerSender(i)
 			}
 			for obj := range processQueue {
+				atomic.AddUint64(&counts.started, 1)
+				if progress != nil {
+					progress.add(obj.index, config.ConnectionsPerHost-1)
+				}
 				for run := uint(0); run < uint(config.ConnectionsPerHost); run++ {
 					result := grabTarget(obj, mon)
-					outputQueue <- result
+					resultQueue <- trackedResult{index: obj.index, result: result}
 				}
+				atomic.AddUint64(&counts.completed, 1)
 			}
 			workerDone.Done()
 		}(i)
 	}
 
-	if err := config.inputTargets(processQueue); err != nil {
-		log.Fatal(err)
+	// The input passes through the optional stages below on its way to the
+	// workers. Each stage closes its output once its input is closed.
+	inputQueue := processQueue
+	if config.ports != nil {
+		// The connect sweep passes only the open ports on to the workers.
+		out := inputQueue
+		inputQueue = make(chan ScanTarget, workers*4)
+		go func(in <-chan ScanTarget) {
+			discoverOpenPorts(in, out, config.ports, config.DiscoveryConcurrency, config.DiscoveryTimeout, discoveryStats)
+			close(out)
+		}(inputQueue)
+	}
+	if resolver != nil {
+		// Domains are expanded into one target for each of their addresses.
+		out := inputQueue
+		inputQueue = make(chan ScanTarget, workers*4)
+		go func(in <-chan ScanTarget) {
+			resolveTargets(in, out, resolver, config.ResolveConcurrency)
+			close(out)
+		}(inputQueue)
+	}
+	var stopCheckpoints chan struct{}
+	if progress != nil {
+		// The progress tracker numbers the targets, and skips those already
+		// scanned when resuming.
+		out := inputQueue
+		inputQueue = make(chan ScanTarget, workers*4)
+		go progress.numberTargets(inputQueue, out)
+		stopCheckpoints = make(chan struct{})
+		go progress.writeCheckpoints(config.CheckpointFile, config.CheckpointInterval, stopCheckpoints)
+	}
+	// The input stops being read when the scan is interrupted. The input
+	// function is then left blocked, since its channel cannot be closed
+	// under it.
+	inputTargets := make(chan ScanTarget, workers*4)
+	go forwardTargets(inputTargets, inputQueue)
+	queues.set(map[string]func() int{
+		"input":  func() int { return len(processQueue) },
+		"output": func() int { return len(resultQueue) },
+	})
+	defer queues.set(nil)
+	go func() {
+		if err := config.inputTargets(inputTargets); err != nil {
+			log.Fatal(err)
+		}
+		close(inputTargets)
+	}()
+
+	var stopUpdates chan struct{}
+	var updatesDone sync.WaitGroup
+	if config.StatusUpdatesInterval > 0 {
+		reporter := newStatusReporter(mon, config.inputFile, time.Now())
+		stopUpdates = make(chan struct{})
+		updatesDone.Add(1)
+		go func() {
+			defer updatesDone.Done()
+			reporter.writeStatusUpdates(config.metaFile, config.StatusUpdatesInterval, stopUpdates)
+		}()
+	}
+
+	workersFinished := make(chan struct{})
+	go func() {
+		workerDone.Wait()
+		close(workersFinished)
+	}()
+	select {
+	case <-workersFinished:
+	case <-interrupted:
+		log.Warnf("interrupted, waiting up to %s for grabs in flight", config.ShutdownGracePeriod)
+		select {
+		case <-workersFinished:
+		case <-time.After(config.ShutdownGracePeriod):
+			log.Warnf("grace period expired, abandoning grabs in flight")
+			atomic.StoreInt32(&abandoned, 1)
+		}
+	}
+	if Abandoned() {
+		close(stopResults)
+	} else {
+		close(resultQueue)
 	}
-	close(processQueue)
-	workerDone.Wait()
-	close(outputQueue)
 	outputDone.Wait()
+	if stopUpdates != nil {
+		// The summary follows the last update in the metadata file.
+		close(stopUpdates)
+		updatesDone.Wait()
+	}
+	if progress != nil {
+		close(stopCheckpoints)
+		if err := progress.finish(Interrupted()).Save(config.CheckpointFile); err != nil {
+			log.Errorf("could not write checkpoint: %s", err)
+		}
+	}
 }
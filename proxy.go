@@ -0,0 +1,417 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// proxies are the servers that connections go through, from --proxy or
+// --proxy-file. Each new connection uses the next one in turn. proxies is
+// empty if connections are made directly.
+var (
+	proxies   []*url.URL
+	proxyNext uint64
+)
+
+// parseProxy parses a proxy URL, which must use the socks5 or http scheme.
+func parseProxy(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "socks5", "http":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme in %q, expected socks5:// or http://", s)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("no port in proxy %q", s)
+	}
+	return u, nil
+}
+
+// loadProxies reads a list of proxy URLs from a file, one per line. Blank
+// lines and lines starting with # are ignored.
+func loadProxies(path string) ([]*url.URL, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ret []*url.URL
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		u, err := parseProxy(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		ret = append(ret, u)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no proxies in %s", path)
+	}
+	return ret, nil
+}
+
+// nextProxy returns the proxy for a new connection, or nil if there are no
+// proxies.
+func nextProxy() *url.URL {
+	if len(proxies) == 0 {
+		return nil
+	}
+	n := atomic.AddUint64(&proxyNext, 1) - 1
+	return proxies[n%uint64(len(proxies))]
+}
+
+// dialNetwork makes a connection to address with d, through the next proxy
+// if there are any. TCP goes through either kind of proxy, and UDP only
+// through a SOCKS5 proxy, with UDP ASSOCIATE.
+func dialNetwork(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+	proxy := nextProxy()
+	if proxy == nil {
+		return filterDialer(d).DialContext(ctx, network, address)
+	}
+	if strings.HasPrefix(network, "udp") {
+		if proxy.Scheme != "socks5" {
+			return nil, fmt.Errorf("cannot send UDP through %s proxy %s", proxy.Scheme, proxy.Host)
+		}
+		if err := checkProxiedAddress(address); err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		return dialSOCKS5UDP(ctx, d, proxy, address)
+	}
+	// A custom resolver (such as the one the http module uses to pin the
+	// target's address) must be used here, rather than by the proxy.
+	if host, port, err := net.SplitHostPort(address); err == nil && d.Resolver != nil && net.ParseIP(host) == nil {
+		addrs, err := d.Resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) > 0 {
+			address = net.JoinHostPort(addrs[0].IP.String(), port)
+		}
+	}
+	if err := checkProxiedAddress(address); err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	conn, err := d.DialContext(ctx, "tcp", proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	// The handshake with the proxy is bounded by the dial timeout.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else if d.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(d.Timeout))
+	}
+	tunnel := conn
+	if proxy.Scheme == "socks5" {
+		_, err = socks5Handshake(conn, proxy, socks5Connect, address)
+	} else {
+		tunnel, err = httpConnect(conn, proxy, address)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, &net.OpError{Op: "dial", Net: network, Err: fmt.Errorf("proxy %s: %v", proxy.Host, err)}
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+// SOCKS5 commands (RFC 1928).
+const (
+	socks5Connect      = 1
+	socks5UDPAssociate = 3
+)
+
+// socks5Replies are the meanings of the SOCKS5 reply codes.
+var socks5Replies = []string{
+	"succeeded",
+	"general SOCKS server failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+// socks5Handshake authenticates to the SOCKS5 proxy on conn, with the user
+// and password from its URL if any, and sends a request with the given
+// command and address. It returns the address bound by the proxy.
+func socks5Handshake(conn net.Conn, proxy *url.URL, command byte, address string) (*net.UDPAddr, error) {
+	methods := []byte{0}
+	if proxy.User != nil {
+		methods = []byte{0, 2}
+	}
+	if _, err := conn.Write(append([]byte{5, byte(len(methods))}, methods...)); err != nil {
+		return nil, err
+	}
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return nil, err
+	}
+	switch {
+	case reply[0] != 5:
+		return nil, fmt.Errorf("not a SOCKS5 server")
+	case reply[1] == 2 && proxy.User != nil:
+		user := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		if len(user) > 255 || len(password) > 255 {
+			return nil, errors.New("SOCKS5 user or password too long")
+		}
+		auth := append([]byte{1, byte(len(user))}, user...)
+		auth = append(append(auth, byte(len(password))), password...)
+		if _, err := conn.Write(auth); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return nil, err
+		}
+		if reply[1] != 0 {
+			return nil, errors.New("SOCKS5 authentication failed")
+		}
+	case reply[1] != 0:
+		return nil, errors.New("no acceptable SOCKS5 authentication method")
+	}
+
+	request, err := socks5Address(address)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append([]byte{5, command, 0}, request...)); err != nil {
+		return nil, err
+	}
+	var header [3]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return nil, err
+	}
+	if header[1] != 0 {
+		if int(header[1]) < len(socks5Replies) {
+			return nil, errors.New(socks5Replies[header[1]])
+		}
+		return nil, fmt.Errorf("SOCKS5 reply %d", header[1])
+	}
+	return readSOCKS5Address(conn)
+}
+
+// socks5Address encodes a host:port address as a SOCKS5 ATYP, DST.ADDR and
+// DST.PORT.
+func socks5Address(address string) ([]byte, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %q", address)
+	}
+	var ret []byte
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("host name too long: %s", host)
+		}
+		ret = append([]byte{3, byte(len(host))}, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		ret = append([]byte{1}, ip4...)
+	} else {
+		ret = append([]byte{4}, ip.To16()...)
+	}
+	return append(ret, byte(port>>8), byte(port)), nil
+}
+
+// readSOCKS5Address reads an ATYP, address and port. Host names are not
+// resolved, and give a nil IP.
+func readSOCKS5Address(r io.Reader) (*net.UDPAddr, error) {
+	var atyp [1]byte
+	if _, err := io.ReadFull(r, atyp[:]); err != nil {
+		return nil, err
+	}
+	var addr []byte
+	switch atyp[0] {
+	case 1:
+		addr = make([]byte, net.IPv4len)
+	case 4:
+		addr = make([]byte, net.IPv6len)
+	case 3:
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return nil, err
+		}
+		addr = make([]byte, n[0])
+	default:
+		return nil, fmt.Errorf("invalid SOCKS5 address type %d", atyp[0])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(r, addr); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return nil, err
+	}
+	ret := &net.UDPAddr{Port: int(binary.BigEndian.Uint16(port[:]))}
+	if atyp[0] != 3 {
+		ret.IP = net.IP(addr)
+	}
+	return ret, nil
+}
+
+// httpConnect opens a tunnel to address through the HTTP proxy on conn.
+func httpConnect(conn net.Conn, proxy *url.URL, address string) (net.Conn, error) {
+	request := "CONNECT " + address + " HTTP/1.1\r\nHost: " + address + "\r\n"
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		request += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	if _, err := io.WriteString(conn, request+"\r\n"); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT failed: %s", response.Status)
+	}
+	// The server may already have sent data through the tunnel, which the
+	// reader has buffered.
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn is a net.Conn whose reads go through a bufio.Reader.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// socks5UDPConn sends and receives the datagrams of a UDP "connection" to
+// a single address through a SOCKS5 relay. The TCP connection to the proxy
+// is held open for as long as the association lasts.
+type socks5UDPConn struct {
+	*net.UDPConn
+	control net.Conn
+	remote  net.Addr
+	header  []byte
+}
+
+// hostAddr is the address of a UDP target given by a domain, which only the
+// proxy resolves.
+type hostAddr string
+
+func (a hostAddr) Network() string { return "udp" }
+func (a hostAddr) String() string  { return string(a) }
+
+// dialSOCKS5UDP associates a UDP relay on the SOCKS5 proxy, and returns a
+// connection to address through it.
+func dialSOCKS5UDP(ctx context.Context, d *net.Dialer, proxy *url.URL, address string) (net.Conn, error) {
+	// A domain is sent to the proxy in the header of each datagram, rather
+	// than resolved here, where the lookup would bypass the proxy.
+	var remote net.Addr = hostAddr(address)
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			p, _ := strconv.Atoi(port)
+			remote = &net.UDPAddr{IP: ip, Port: p}
+		}
+	}
+	header, err := socks5Address(address)
+	if err != nil {
+		return nil, err
+	}
+	control, err := d.DialContext(ctx, "tcp", proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		control.SetDeadline(deadline)
+	} else if d.Timeout > 0 {
+		control.SetDeadline(time.Now().Add(d.Timeout))
+	}
+	relay, err := socks5Handshake(control, proxy, socks5UDPAssociate, "0.0.0.0:0")
+	if err != nil {
+		control.Close()
+		return nil, &net.OpError{Op: "dial", Net: "udp", Err: fmt.Errorf("proxy %s: %v", proxy.Host, err)}
+	}
+	control.SetDeadline(time.Time{})
+	// A relay on an unspecified address is on the proxy itself.
+	if relay.IP == nil || relay.IP.IsUnspecified() {
+		relay.IP = control.RemoteAddr().(*net.TCPAddr).IP
+	}
+	conn, err := net.DialUDP("udp", nil, relay)
+	if err != nil {
+		control.Close()
+		return nil, err
+	}
+	return &socks5UDPConn{
+		UDPConn: conn,
+		control: control,
+		remote:  remote,
+		header:  append([]byte{0, 0, 0}, header...),
+	}, nil
+}
+
+// Write sends b to the remote address in a single datagram.
+func (c *socks5UDPConn) Write(b []byte) (int, error) {
+	if _, err := c.UDPConn.Write(append(append([]byte{}, c.header...), b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read reads the payload of the next datagram relayed by the proxy.
+// Fragmented datagrams are dropped.
+func (c *socks5UDPConn) Read(b []byte) (int, error) {
+	buf := make([]byte, len(b)+262)
+	for {
+		n, err := c.UDPConn.Read(buf)
+		if err != nil {
+			return 0, err
+		}
+		if n < 4 || buf[2] != 0 {
+			continue
+		}
+		reader := bytes.NewReader(buf[3:n])
+		if _, err := readSOCKS5Address(reader); err != nil {
+			continue
+		}
+		return copy(b, buf[n-reader.Len():n]), nil
+	}
+}
+
+// RemoteAddr returns the target's address, rather than the relay's.
+func (c *socks5UDPConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Close ends the association.
+func (c *socks5UDPConn) Close() error {
+	c.control.Close()
+	return c.UDPConn.Close()
+}
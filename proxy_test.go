@@ -0,0 +1,232 @@
+package zgrab2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// serveSOCKS5 runs a minimal SOCKS5 server on l, requiring the user "u"
+// with the password "p". CONNECT requests are tunneled to the requested
+// address. UDP ASSOCIATE requests get a relay that echoes each datagram
+// back to the client, as if the target had answered with the same data.
+func serveSOCKS5(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			buf := make([]byte, 512)
+			io.ReadFull(conn, buf[:2])
+			io.ReadFull(conn, buf[:buf[1]])
+			conn.Write([]byte{5, 2})
+			io.ReadFull(conn, buf[:2])
+			n := buf[1]
+			io.ReadFull(conn, buf[:n])
+			user := string(buf[:n])
+			io.ReadFull(conn, buf[:1])
+			n = buf[0]
+			io.ReadFull(conn, buf[:n])
+			if user != "u" || string(buf[:n]) != "p" {
+				conn.Write([]byte{1, 1})
+				return
+			}
+			conn.Write([]byte{1, 0})
+			io.ReadFull(conn, buf[:3])
+			command := buf[1]
+			addr, err := readSOCKS5Address(conn)
+			if err != nil {
+				return
+			}
+			if command == socks5UDPAssociate {
+				relay, _ := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+				defer relay.Close()
+				bound, _ := socks5Address(relay.LocalAddr().String())
+				conn.Write(append([]byte{5, 0, 0}, bound...))
+				go func() {
+					for {
+						n, from, err := relay.ReadFrom(buf)
+						if err != nil {
+							return
+						}
+						relay.WriteTo(buf[:n], from)
+					}
+				}()
+				io.Copy(ioutil.Discard, conn)
+				return
+			}
+			target, err := net.Dial("tcp", addr.String())
+			if err != nil {
+				conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+				return
+			}
+			defer target.Close()
+			conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+			go io.Copy(target, conn)
+			io.Copy(conn, target)
+		}(conn)
+	}
+}
+
+// serveHTTPConnect runs a minimal HTTP proxy on l, which answers a CONNECT
+// with the banner of a server-first protocol in the same write.
+func serveHTTPConnect(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func(conn net.Conn) {
+			defer conn.Close()
+			request, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil || request.Method != "CONNECT" {
+				return
+			}
+			conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\nSSH-2.0-test\r\n"))
+		}(conn)
+	}
+}
+
+func TestProxyTCP(t *testing.T) {
+	defer func(saved []*url.URL) {
+		proxies = saved
+	}(proxies)
+	echo, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	socks, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer socks.Close()
+	go serveSOCKS5(socks)
+
+	proxy, _ := parseProxy("socks5://u:p@" + socks.Addr().String())
+	proxies = []*url.URL{proxy}
+	conn, err := DialTimeoutConnection("tcp", echo.Addr().String(), time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("wrong echo through SOCKS5: %q, %v", buf, err)
+	}
+	conn.Close()
+
+	badAuth, _ := parseProxy("socks5://u:wrong@" + socks.Addr().String())
+	proxies = []*url.URL{badAuth}
+	if _, err := DialTimeoutConnection("tcp", echo.Addr().String(), time.Second, 0); err == nil {
+		t.Error("expected an authentication error")
+	}
+
+	httpProxy, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer httpProxy.Close()
+	go serveHTTPConnect(httpProxy)
+	proxy, _ = parseProxy("http://" + httpProxy.Addr().String())
+	proxies = []*url.URL{proxy}
+	conn, err = NewDialer(nil).DialContext(context.Background(), "tcp", "192.0.2.1:22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || banner != "SSH-2.0-test\r\n" {
+		t.Errorf("wrong banner through HTTP CONNECT: %q, %v", banner, err)
+	}
+}
+
+func TestProxyUDP(t *testing.T) {
+	defer func(saved []*url.URL) {
+		proxies = saved
+	}(proxies)
+	socks, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer socks.Close()
+	go serveSOCKS5(socks)
+	proxy, _ := parseProxy("socks5://u:p@" + socks.Addr().String())
+	proxies = []*url.URL{proxy}
+
+	conn, err := dialNetwork(context.Background(), &net.Dialer{Timeout: time.Second}, "udp", "192.0.2.1:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.RemoteAddr().String() != "192.0.2.1:53" {
+		t.Errorf("wrong remote address %s", conn.RemoteAddr())
+	}
+	conn.SetDeadline(time.Now().Add(time.Second))
+	conn.Write([]byte("query"))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "query" {
+		t.Errorf("wrong datagram through SOCKS5: %q, %v", buf[:n], err)
+	}
+
+	// A domain is left for the proxy to resolve.
+	conn, err = dialNetwork(context.Background(), &net.Dialer{Timeout: time.Second}, "udp", "scan.invalid:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.RemoteAddr().String() != "scan.invalid:53" {
+		t.Errorf("wrong remote address %s", conn.RemoteAddr())
+	}
+	if header := conn.(*socks5UDPConn).header; header[3] != 3 {
+		t.Errorf("domain not sent to the proxy: %v", header)
+	}
+	conn.SetDeadline(time.Now().Add(time.Second))
+	conn.Write([]byte("query"))
+	if n, err := conn.Read(buf); err != nil || string(buf[:n]) != "query" {
+		t.Errorf("wrong datagram for a domain through SOCKS5: %q, %v", buf[:n], err)
+	}
+
+	proxy, _ = parseProxy("http://127.0.0.1:8080")
+	proxies = []*url.URL{proxy}
+	if _, err := dialNetwork(context.Background(), &net.Dialer{}, "udp", "192.0.2.1:53"); err == nil {
+		t.Error("expected an error for UDP through an HTTP proxy")
+	}
+}
+
+func TestSOCKS5Address(t *testing.T) {
+	tests := []struct {
+		address  string
+		expected []byte
+	}{
+		{"10.0.0.1:80", []byte{1, 10, 0, 0, 1, 0, 80}},
+		{"[::1]:443", []byte{4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 187}},
+		{"example.com:8080", append(append([]byte{3, 11}, "example.com"...), 0x1f, 0x90)},
+	}
+	for _, test := range tests {
+		encoded, err := socks5Address(test.address)
+		if err != nil || !bytes.Equal(encoded, test.expected) {
+			t.Errorf("socks5Address(%s) = %v, %v", test.address, encoded, err)
+			continue
+		}
+		decoded, err := readSOCKS5Address(bytes.NewReader(encoded))
+		if err != nil || (decoded.IP != nil && decoded.String() != test.address) {
+			t.Errorf("readSOCKS5Address(%v) = %v, %v", encoded, decoded, err)
+		}
+	}
+	for _, bad := range []string{"ftp://host:21", "socks5://host", "socks5://%zz"} {
+		if _, err := parseProxy(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package zgrab2
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a rate limiter. Tokens accumulate at rate per second, up to
+// burst. Taking more tokens than are available puts the bucket in debt, which
+// later callers wait out, so a large read or write is paid for after the
+// fact rather than split up. A nil *tokenBucket does not limit anything.
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket with the given rate and burst. A
+// burst below one is raised to one.
+func newTokenBucket(rate float64, burst float64) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// refill adds the tokens accumulated since the last call. The caller must
+// hold the mutex.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// take removes n tokens, and returns how long it will be until the bucket is
+// out of debt.
+func (b *tokenBucket) take(n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill(time.Now())
+	b.tokens -= n
+	return b.debt()
+}
+
+// debt returns how long it will be until the bucket is out of debt. The
+// caller must hold the mutex.
+func (b *tokenBucket) debt() time.Duration {
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// wait blocks until the bucket is out of debt, or ctx is done.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mutex.Lock()
+	b.refill(time.Now())
+	delay := b.debt()
+	b.mutex.Unlock()
+	return sleepContext(ctx, delay)
+}
+
+// sleepContext sleeps for d, or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	if ctx == nil {
+		time.Sleep(d)
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connectLimiter and bytesLimiter enforce --connections-per-second and
+// --bytes-per-second across all scanners. They are nil if unlimited.
+var (
+	connectLimiter *tokenBucket
+	bytesLimiter   *tokenBucket
+)
+
+// waitToConnect takes a token for a new connection, waiting if the rate
+// limit has been reached.
+func waitToConnect(ctx context.Context) error {
+	return sleepContext(ctx, connectLimiter.take(1))
+}
@@ -0,0 +1,85 @@
+package zgrab2
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(100, 10)
+	// The burst is available at once.
+	for i := 0; i < 10; i++ {
+		if d := b.take(1); d != 0 {
+			t.Fatalf("take %d: expected no delay, got %s", i, d)
+		}
+	}
+	// The next token comes after 1/rate.
+	if d := b.take(1); d <= 0 || d > 10*time.Millisecond {
+		t.Errorf("expected a delay of about 10ms, got %s", d)
+	}
+	// A large take goes into debt, which wait pays off.
+	b.take(20)
+	start := time.Now()
+	if err := b.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected to wait about 200ms, waited %s", elapsed)
+	}
+
+	// Waiting is cut short by the context.
+	b.take(100)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the context to expire, got %v", err)
+	}
+
+	// A nil bucket does not limit.
+	var unlimited *tokenBucket
+	if d := unlimited.take(1e9); d != 0 {
+		t.Errorf("expected no delay from a nil bucket, got %s", d)
+	}
+	if err := unlimited.wait(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRateLimitWaitsOutsideTimeouts(t *testing.T) {
+	defer func() {
+		connectLimiter, bytesLimiter = nil, nil
+	}()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("hello"))
+		time.Sleep(time.Second)
+	}()
+
+	// The limiters are in debt for longer than the timeouts.
+	connectLimiter = newTokenBucket(10, 1)
+	connectLimiter.take(3)
+	d := NewDialer(&Dialer{Timeout: 5 * time.Second, ConnectTimeout: 50 * time.Millisecond, ReadTimeout: 50 * time.Millisecond})
+	conn, err := d.DialContext(context.Background(), "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("dial failed while waiting on the rate limit: %v", err)
+	}
+	defer conn.Close()
+	bytesLimiter = newTokenBucket(10, 1)
+	bytesLimiter.take(3)
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Errorf("read failed while waiting on the rate limit: %v", err)
+	}
+}
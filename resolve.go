@@ -0,0 +1,173 @@
+package zgrab2
+
+import (
+	"container/list"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resolution records the DNS lookup of a target given only by its domain.
+type Resolution struct {
+	// Addresses are all of the addresses found, including those excluded by
+	// the allowlist or blocklist. The target is scanned once on each of the
+	// others.
+	Addresses []string `json:"addresses"`
+
+	// Error is set if the lookup failed, in which case the target is not
+	// scanned.
+	Error string `json:"error,omitempty"`
+
+	// duration is how long the lookup took, or 0 if it was cached.
+	duration time.Duration
+}
+
+// targetResolver looks up the addresses of the domain targets, caching the
+// results, when --resolve or --resolver is given.
+type targetResolver struct {
+	resolver *net.Resolver
+	// network is "ip4", "ip6" or "ip", for A, AAAA or both records.
+	network string
+	timeout time.Duration
+
+	mutex sync.Mutex
+	// cache holds up to cacheSize lookups (any number if 0), keyed by the
+	// lower-cased domain. recent orders them from the most recently used.
+	cache     map[string]*list.Element
+	recent    *list.List
+	cacheSize int
+}
+
+// resolverEntry is a cached lookup, which is ready once done is closed.
+type resolverEntry struct {
+	key        string
+	done       chan struct{}
+	resolution *Resolution
+	ips        []net.IP
+}
+
+// newTargetResolver returns a targetResolver using the DNS server at
+// address (ip:port), or the system resolver if address is empty. recordType
+// is "a", "aaaa" or "both". Up to cacheSize lookups are cached, or any
+// number if it is 0.
+func newTargetResolver(address string, recordType string, timeout time.Duration, cacheSize int) *targetResolver {
+	ret := &targetResolver{
+		resolver:  net.DefaultResolver,
+		network:   map[string]string{"a": "ip4", "aaaa": "ip6", "both": "ip"}[recordType],
+		timeout:   timeout,
+		cache:     make(map[string]*list.Element),
+		recent:    list.New(),
+		cacheSize: cacheSize,
+	}
+	if address != "" {
+		ret.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, address)
+			},
+		}
+	}
+	return ret
+}
+
+// resolver is nil unless the resolution stage is enabled.
+var resolver *targetResolver
+
+// lookup returns the addresses of domain, looking them up only once. The
+// Resolution of a cached lookup is a copy with no duration, since no time
+// was spent on it.
+func (r *targetResolver) lookup(domain string) ([]net.IP, *Resolution) {
+	key := strings.ToLower(domain)
+	r.mutex.Lock()
+	var entry *resolverEntry
+	element, ok := r.cache[key]
+	if ok {
+		r.recent.MoveToFront(element)
+		entry = element.Value.(*resolverEntry)
+	} else {
+		entry = &resolverEntry{key: key, done: make(chan struct{})}
+		r.cache[key] = r.recent.PushFront(entry)
+		if r.cacheSize > 0 && r.recent.Len() > r.cacheSize {
+			// A lookup still in progress may be evicted; those waiting on
+			// it keep their reference to it.
+			oldest := r.recent.Remove(r.recent.Back()).(*resolverEntry)
+			delete(r.cache, oldest.key)
+		}
+	}
+	r.mutex.Unlock()
+	if ok {
+		<-entry.done
+		cached := *entry.resolution
+		cached.duration = 0
+		return entry.ips, &cached
+	}
+	defer close(entry.done)
+	entry.resolution = &Resolution{Addresses: []string{}}
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+	start := time.Now()
+	// Only the records of the requested type are queried.
+	ips, err := r.resolver.LookupIP(ctx, r.network, domain)
+	entry.resolution.duration = time.Since(start)
+	if err != nil {
+		entry.resolution.Error = err.Error()
+		return nil, entry.resolution
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		entry.ips = append(entry.ips, ip)
+		entry.resolution.Addresses = append(entry.resolution.Addresses, ip.String())
+	}
+	if len(entry.ips) == 0 {
+		entry.resolution.Error = (&net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}).Error()
+	}
+	return entry.ips, entry.resolution
+}
+
+// resolveTargets reads targets from in, and delivers to out a copy of each
+// target given only by its domain for each of its addresses, keeping the
+// domain. Addresses excluded by the allowlist or blocklist are skipped. A
+// target whose lookup fails is delivered once, without an address, to
+// record the error. Other targets are passed on unchanged. Up to concurrency
+// lookups run at once. out is not closed.
+func resolveTargets(in <-chan ScanTarget, out chan<- ScanTarget, r *targetResolver, concurrency int) {
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for target := range in {
+				if target.IP != nil || target.Domain == "" {
+					out <- target
+					continue
+				}
+				ips, resolution := r.lookup(target.Domain)
+				target.resolution = resolution
+				if resolution.Error != "" {
+					out <- target
+					continue
+				}
+				var allowed []net.IP
+				for _, ip := range ips {
+					if targetFilter.allowsTarget(ip) {
+						allowed = append(allowed, ip)
+					}
+				}
+				if progress != nil {
+					progress.add(target.index, len(allowed)-1)
+				}
+				for _, ip := range allowed {
+					t := target
+					t.IP = ip
+					out <- t
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
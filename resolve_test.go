@@ -0,0 +1,137 @@
+package zgrab2
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResolveTargets(t *testing.T) {
+	fake, err := NewFakeResolver("10.1.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := uint(443)
+	tests := []struct {
+		recordType string
+		target     ScanTarget
+		expected   []string
+		errored    bool
+	}{
+		{"a", ScanTarget{Domain: "example.com", Port: &port}, []string{"example.com(10.1.2.3) port:443"}, false},
+		{"both", ScanTarget{Domain: "example.com"}, []string{"example.com(10.1.2.3)"}, false},
+		{"aaaa", ScanTarget{Domain: "example.com"}, []string{"example.com"}, true},
+		{"a", ScanTarget{IP: []byte{10, 0, 0, 1}, Domain: "example.com"}, []string{"example.com(10.0.0.1)"}, false},
+	}
+	for _, test := range tests {
+		r := newTargetResolver("", test.recordType, time.Second, 0)
+		r.resolver = fake
+		in := make(chan ScanTarget, 1)
+		out := make(chan ScanTarget, 8)
+		in <- test.target
+		close(in)
+		resolveTargets(in, out, r, 2)
+		close(out)
+		var got []string
+		var last ScanTarget
+		for target := range out {
+			got = append(got, target.String())
+			last = target
+		}
+		checkTargets(t, got, test.expected)
+		if test.target.IP != nil {
+			if last.resolution != nil {
+				t.Errorf("%s: a target with an address was looked up", test.target.String())
+			}
+			continue
+		}
+		if last.resolution == nil || (last.resolution.Error != "") != test.errored {
+			t.Errorf("%s (%s): wrong resolution %+v", test.target.String(), test.recordType, last.resolution)
+		}
+	}
+}
+
+func TestResolverCache(t *testing.T) {
+	fake, _ := NewFakeResolver("10.1.2.3")
+	r := newTargetResolver("", "a", time.Second, 0)
+	r.resolver = fake
+	_, first := r.lookup("example.com")
+	_, second := r.lookup("EXAMPLE.com")
+	_, third := r.lookup("example.org")
+	if first.duration <= 0 {
+		t.Errorf("got duration %s for the lookup", first.duration)
+	}
+	if first == second || second.duration != 0 || strings.Join(second.Addresses, ",") != "10.1.2.3" {
+		t.Errorf("the lookup was not cached: %+v", second)
+	}
+	if first == third || strings.Join(third.Addresses, ",") != "10.1.2.3" {
+		t.Errorf("wrong lookup of another name: %+v", third)
+	}
+}
+
+func TestResolveTargetsCheckpoint(t *testing.T) {
+	defer func(filter *addressFilter, tracker *progressTracker) {
+		targetFilter, progress = filter, tracker
+	}(targetFilter, progress)
+	block, _ := readPrefixTree(strings.NewReader("10.1.2.3\n"))
+	targetFilter = &addressFilter{block: block}
+	progress = newProgressTracker(nil)
+
+	fake, _ := NewFakeResolver("10.1.2.3")
+	r := newTargetResolver("", "a", time.Second, 0)
+	r.resolver = fake
+	numbered := make(chan ScanTarget, 2)
+	in := make(chan ScanTarget, 2)
+	numbered <- ScanTarget{Domain: "example.com"}
+	numbered <- ScanTarget{Domain: "example.org"}
+	close(numbered)
+	progress.numberTargets(numbered, in)
+	out := make(chan ScanTarget, 2)
+	resolveTargets(in, out, r, 1)
+	close(out)
+	if len(out) != 0 {
+		t.Fatalf("%d blocked targets were delivered", len(out))
+	}
+	// Every address of both targets was blocked, so both are done.
+	checkpoint := progress.finish(false)
+	if checkpoint.Offset != 2 || len(checkpoint.InFlight) != 0 || !checkpoint.Complete {
+		t.Errorf("wrong checkpoint: %+v", checkpoint)
+	}
+}
+
+func TestResolverQueriesRecordType(t *testing.T) {
+	fake, _ := NewFakeResolver("10.1.2.3")
+	var queries int32
+	dial := fake.Dial
+	fake.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		atomic.AddInt32(&queries, 1)
+		return dial(ctx, network, address)
+	}
+	r := newTargetResolver("", "a", time.Second, 0)
+	r.resolver = fake
+	if ips, _ := r.lookup("example.com"); len(ips) != 1 {
+		t.Fatalf("got %v", ips)
+	}
+	if n := atomic.LoadInt32(&queries); n != 1 {
+		t.Errorf("sent %d queries for A records only", n)
+	}
+}
+
+func TestResolverCacheSize(t *testing.T) {
+	fake, _ := NewFakeResolver("10.1.2.3")
+	r := newTargetResolver("", "a", time.Second, 2)
+	r.resolver = fake
+	r.lookup("a.example")
+	r.lookup("b.example")
+	r.lookup("a.example")
+	r.lookup("c.example")
+	if len(r.cache) != 2 || r.recent.Len() != 2 {
+		t.Fatalf("cache holds %d entries, expected 2", len(r.cache))
+	}
+	if r.cache["b.example"] != nil || r.cache["a.example"] == nil || r.cache["c.example"] == nil {
+		t.Errorf("the least recently used lookup was not evicted")
+	}
+}
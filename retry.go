@@ -0,0 +1,66 @@
+package zgrab2
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// parseRetryOn checks the --retry-on statuses, and prepares them for
+// shouldRetry.
+func (b *BaseFlags) parseRetryOn() error {
+	b.retryOn = make(map[ScanStatus]bool)
+	for _, s := range strings.Split(b.RetryOn, ",") {
+		status := ScanStatus(strings.TrimSpace(s))
+		if status == "" {
+			continue
+		}
+		if !isScanStatus(status) || status == SCAN_SUCCESS {
+			return fmt.Errorf("invalid --retry-on status %q", status)
+		}
+		b.retryOn[status] = true
+	}
+	return nil
+}
+
+// shouldRetry reports whether a scan that has been tried the given number
+// of times, and last ended with status, should be tried again.
+func (b *BaseFlags) shouldRetry(status ScanStatus, attempts int) bool {
+	return b != nil && attempts <= b.Retries && b.retryOn[status] && !Interrupted()
+}
+
+// retryDelay returns how long to wait before the next try of a scan that
+// has been tried the given number of times. The delay doubles with each
+// try, up to --retry-max-backoff if set, and a random part of up to half of
+// it is taken off, so that retries of targets that failed together are
+// spread out.
+func (b *BaseFlags) retryDelay(attempts int) time.Duration {
+	delay := b.RetryBackoff
+	for i := 1; i < attempts && i < 32; i++ {
+		if b.RetryMaxBackoff > 0 && delay >= b.RetryMaxBackoff {
+			break
+		}
+		delay *= 2
+	}
+	if b.RetryMaxBackoff > 0 && delay > b.RetryMaxBackoff {
+		delay = b.RetryMaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay - time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// waitToRetry sleeps for d, and returns false if the scan is interrupted in
+// the meantime.
+func waitToRetry(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-interrupted:
+		return false
+	}
+}
@@ -0,0 +1,99 @@
+package zgrab2
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyScanner fails with each of its statuses in turn, then succeeds.
+type flakyScanner struct {
+	fakeScanner
+	statuses []ScanStatus
+	tries    int
+}
+
+func (s *flakyScanner) Scan(t ScanTarget) (ScanStatus, interface{}, error) {
+	s.tries++
+	if s.tries <= len(s.statuses) {
+		status := s.statuses[s.tries-1]
+		return status, nil, fmt.Errorf("try %d: %s", s.tries, status)
+	}
+	return SCAN_SUCCESS, nil, nil
+}
+
+func TestRunScannerRetries(t *testing.T) {
+	tests := []struct {
+		retries  int
+		retryOn  string
+		statuses []ScanStatus
+		status   ScanStatus
+		attempts int
+		errors   []string
+	}{
+		{
+			retries: 2, retryOn: "connection-timeout,io-timeout",
+			statuses: []ScanStatus{SCAN_CONNECTION_TIMEOUT, SCAN_IO_TIMEOUT},
+			status:   SCAN_SUCCESS, attempts: 3,
+			errors: []string{"try 1: connection-timeout", "try 2: io-timeout"},
+		},
+		{
+			retries: 1, retryOn: "connection-timeout,io-timeout",
+			statuses: []ScanStatus{SCAN_CONNECTION_TIMEOUT, SCAN_IO_TIMEOUT},
+			status:   SCAN_IO_TIMEOUT, attempts: 2,
+			errors: []string{"try 1: connection-timeout"},
+		},
+		{
+			retries: 3, retryOn: "io-timeout",
+			statuses: []ScanStatus{SCAN_CONNECTION_REFUSED},
+			status:   SCAN_CONNECTION_REFUSED, attempts: 1,
+		},
+		{
+			retries: 0, retryOn: "connection-refused",
+			statuses: []ScanStatus{SCAN_CONNECTION_REFUSED},
+			status:   SCAN_CONNECTION_REFUSED,
+		},
+	}
+	var wg sync.WaitGroup
+	mon := MakeMonitor(16, &wg)
+	defer mon.Stop()
+	for i, test := range tests {
+		flags := &BaseFlags{Retries: test.retries, RetryOn: test.retryOn, RetryBackoff: time.Millisecond, RetryMaxBackoff: 4 * time.Millisecond}
+		if err := flags.parseRetryOn(); err != nil {
+			t.Fatal(err)
+		}
+		s := &flakyScanner{fakeScanner: fakeScanner{name: "flaky"}, statuses: test.statuses}
+		_, res := runScanner(s, flags, mon, ScanTarget{})
+		if res.Status != test.status || res.Attempts != test.attempts || !reflect.DeepEqual(res.AttemptErrors, test.errors) {
+			t.Errorf("%d: got status %s after %d attempts, errors %v", i, res.Status, res.Attempts, res.AttemptErrors)
+		}
+	}
+
+	bad := &BaseFlags{RetryOn: "io-timeout,success"}
+	if err := bad.parseRetryOn(); err == nil {
+		t.Error("expected an error for retrying on success")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	flags := &BaseFlags{RetryBackoff: time.Second, RetryMaxBackoff: 5 * time.Second}
+	tests := []struct {
+		attempts int
+		max      time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{40, 5 * time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			if d := flags.retryDelay(test.attempts); d < test.max/2 || d > test.max {
+				t.Errorf("retryDelay(%d) = %s, expected between %s and %s", test.attempts, d, test.max/2, test.max)
+			}
+		}
+	}
+}
@@ -7,16 +7,52 @@ import (
 )
 
 var scanners map[string]*Scanner
+var scannerFlags map[string]ScanFlags
 var orderedScanners []string
 
 // RegisterScan registers each individual scanner to be ran by the framework
 func RegisterScan(name string, s Scanner) {
+	RegisterScanWithFlags(name, s, nil)
+}
+
+// RegisterScanWithFlags registers a scanner along with the flags it was
+// initialized with, which lets the framework consult the options shared by
+// all modules (see BaseFlags) when running the scanner and handling its
+// results.
+func RegisterScanWithFlags(name string, s Scanner, flags ScanFlags) {
 	//add to list and map
 	if scanners[name] != nil {
 		log.Fatalf("name: %s already used", name)
 	}
 	orderedScanners = append(orderedScanners, name)
 	scanners[name] = &s
+	if flags != nil {
+		scannerFlags[name] = flags
+		if base := getScanBaseFlags(name); base != nil {
+			if err := base.parseRetryOn(); err != nil {
+				log.Fatalf("%s: %s", name, err)
+			}
+		}
+	}
+}
+
+// getScanBaseFlags returns the BaseFlags of the named scanner, or nil if it
+// was registered without flags.
+func getScanBaseFlags(name string) *BaseFlags {
+	if f, ok := scannerFlags[name].(interface{ GetBaseFlags() *BaseFlags }); ok {
+		return f.GetBaseFlags()
+	}
+	return nil
+}
+
+// getScanTransport returns "udp" if the named scanner uses the common UDP
+// options (see UDPFlags), and "tcp" otherwise. Scanners that support both
+// return nil from GetUDPFlags when configured for TCP.
+func getScanTransport(name string) string {
+	if f, ok := scannerFlags[name].(interface{ GetUDPFlags() *UDPFlags }); ok && f.GetUDPFlags() != nil {
+		return "udp"
+	}
+	return "tcp"
 }
 
 // PrintScanners prints all registered scanners
@@ -28,21 +64,65 @@ func PrintScanners() {
 
 // RunScanner runs a single scan on a target and returns the resulting data
 func RunScanner(s Scanner, mon *Monitor, target ScanTarget) (string, ScanResponse) {
+	return runScanner(s, nil, mon, target)
+}
+
+// runScanner is RunScanner, retrying the scan as configured by flags (which
+// may be nil).
+func runScanner(s Scanner, flags *BaseFlags, mon *Monitor, target ScanTarget) (string, ScanResponse) {
 	t := time.Now()
+	target.trace = new(scanTrace)
+	scansInFlight.WithLabelValues(s.GetName()).Inc()
 	status, res, e := s.Scan(target)
+	attempts := 1
+	// lastAttempt is the first connection of the last try.
+	lastAttempt := 0
+	var attemptErrors []string
+	for ; flags.shouldRetry(status, attempts); attempts++ {
+		if !waitToRetry(flags.retryDelay(attempts)) {
+			break
+		}
+		if e != nil {
+			attemptErrors = append(attemptErrors, e.Error())
+		} else {
+			attemptErrors = append(attemptErrors, string(status))
+		}
+		lastAttempt = target.trace.count()
+		status, res, e = s.Scan(target)
+	}
+	scansInFlight.WithLabelValues(s.GetName()).Dec()
+	conns := target.trace.stats()
+	outcome := moduleStatus{name: s.GetName(), status: status, duration: time.Since(t), conns: conns}
 	var err *string
 	if e == nil {
-		mon.statusesChan <- moduleStatus{name: s.GetName(), st: statusSuccess}
+		outcome.st = statusSuccess
+		mon.statusesChan <- outcome
 		err = nil
 	} else {
-		mon.statusesChan <- moduleStatus{name: s.GetName(), st: statusFailure}
+		outcome.st = statusFailure
+		mon.statusesChan <- outcome
 		errString := e.Error()
 		err = &errString
 	}
 	resp := ScanResponse{Result: res, Protocol: s.Protocol(), Error: err, Timestamp: t.Format(time.RFC3339), Status: status}
+	if e != nil {
+		resp.ErrorType = TryGetErrorType(e)
+	}
+	resp.Service = identifyService(s, res)
+	if target.source != nil {
+		resp.SourceIP = target.source.String()
+	}
+	if config.ConnectionInfo {
+		resp.Connection = connectionInfo(&target, conns[lastAttempt:])
+	}
+	if flags != nil && flags.Retries > 0 {
+		resp.Attempts = attempts
+		resp.AttemptErrors = attemptErrors
+	}
 	return s.GetName(), resp
 }
 
 func init() {
 	scanners = make(map[string]*Scanner)
+	scannerFlags = make(map[string]ScanFlags)
 }
@@ -0,0 +1,141 @@
+package zgrab2
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ServiceInfo is the identity of the service found by a scan, in a form
+// shared by all modules.
+type ServiceInfo struct {
+	// Product is the name of the software, e.g. "OpenSSH" or "Redis".
+	Product string `json:"product,omitempty"`
+
+	// Version is the version of the software, as reported by the service.
+	Version string `json:"version,omitempty"`
+
+	// Vendor is the CPE vendor name of the software, e.g. "openbsd".
+	Vendor string `json:"vendor,omitempty"`
+
+	// CPE is the CPE 2.3 formatted string naming the software (see FormatCPE).
+	CPE string `json:"cpe,omitempty"`
+
+	// Confidence is how certain the identification is, from 1 (a guess) to
+	// 10 (positively identified), as with nmap service detection.
+	Confidence int `json:"confidence,omitempty"`
+}
+
+// ServiceIdentifier is an optional interface a Scanner may implement to
+// report the identity of the service it found. The framework calls
+// IdentifyService with the result of every scan, and stores the returned
+// ServiceInfo, if any, in the Service field of the ScanResponse.
+type ServiceIdentifier interface {
+	// IdentifyService returns the service identified by the given scan
+	// result, or nil if the result does not identify it.
+	IdentifyService(result interface{}) *ServiceInfo
+}
+
+// identifyService asks the scanner to identify the service from its result,
+// if it implements ServiceIdentifier.
+func identifyService(s Scanner, result interface{}) *ServiceInfo {
+	identifier, ok := s.(ServiceIdentifier)
+	if !ok || result == nil {
+		return nil
+	}
+	return identifier.IdentifyService(result)
+}
+
+// BannerPattern identifies the software that sent a banner, for modules
+// that identify the service by its greeting.
+type BannerPattern struct {
+	// Regexp matches the banner. Its first submatch, if any, is the version.
+	Regexp *regexp.Regexp
+
+	// Product is the name of the software.
+	Product string
+
+	// Vendor and CPEProduct are the CPE vendor and product names. No CPE is
+	// given if Vendor is empty.
+	Vendor     string
+	CPEProduct string
+}
+
+// IdentifyBanner returns the service identified by the first of patterns
+// that matches banner, or nil if none does. The identification is certain
+// when the banner gives the version, and a guess otherwise.
+func IdentifyBanner(banner string, patterns []BannerPattern) *ServiceInfo {
+	for _, pattern := range patterns {
+		match := pattern.Regexp.FindStringSubmatch(banner)
+		if match == nil {
+			continue
+		}
+		info := &ServiceInfo{Product: pattern.Product, Vendor: pattern.Vendor, Confidence: 8}
+		if len(match) > 1 && match[1] != "" {
+			info.Version = match[1]
+			info.Confidence = 10
+		}
+		if pattern.Vendor != "" {
+			info.CPE = FormatCPE(pattern.Vendor, pattern.CPEProduct, info.Version)
+		}
+		return info
+	}
+	return nil
+}
+
+// FormatCPE returns the CPE 2.3 formatted string for an application with the
+// given vendor, product and version names. Empty names are encoded as the
+// ANY value, and special characters are quoted.
+func FormatCPE(vendor string, product string, version string) string {
+	return strings.Join([]string{
+		"cpe", "2.3", "a",
+		cpeComponent(vendor), cpeComponent(product), cpeComponent(version),
+		"*", "*", "*", "*", "*", "*", "*",
+	}, ":")
+}
+
+// CPEFromURI converts a CPE 2.2 URI, e.g. "cpe:/a:openbsd:openssh:7.4", as
+// used by nmap, to a CPE 2.3 formatted string. It returns "" if uri is not a
+// CPE URI.
+func CPEFromURI(uri string) string {
+	if !strings.HasPrefix(uri, "cpe:/") {
+		return ""
+	}
+	parts := strings.Split(uri[len("cpe:/"):], ":")
+	ret := []string{"cpe", "2.3"}
+	for i := 0; i < 11; i++ {
+		switch {
+		case i == 0 && parts[0] != "":
+			ret = append(ret, parts[0])
+		case i > 0 && i < 6 && i < len(parts):
+			ret = append(ret, cpeComponent(strings.Replace(parts[i], "%20", " ", -1)))
+		default:
+			ret = append(ret, "*")
+		}
+	}
+	return strings.Join(ret, ":")
+}
+
+// cpeComponent encodes a single attribute value of a CPE 2.3 formatted
+// string: lower case, with whitespace replaced by underscores and any
+// characters other than alphanumerics, "_", "." and "-" quoted with a
+// backslash.
+func cpeComponent(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return "*"
+	}
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r == ' ' || r == '\t':
+			b.WriteRune('_')
+		case r == '_' || r == '.' || r == '-' ||
+			(r >= 'a' && r <= 'z') || (r >= '0' && r <= '9'):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
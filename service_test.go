@@ -0,0 +1,72 @@
+package zgrab2
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestFormatCPE(t *testing.T) {
+	tests := []struct {
+		vendor, product, version string
+		expected                 string
+	}{
+		{"openbsd", "openssh", "7.4p1", "cpe:2.3:a:openbsd:openssh:7.4p1:*:*:*:*:*:*:*"},
+		{"redis", "redis", "", "cpe:2.3:a:redis:redis:*:*:*:*:*:*:*:*"},
+		{"Apache", "HTTP Server", "2.4.41", "cpe:2.3:a:apache:http_server:2.4.41:*:*:*:*:*:*:*"},
+		{"acme", "widget", "1.0+build:5", "cpe:2.3:a:acme:widget:1.0\\+build\\:5:*:*:*:*:*:*:*"},
+	}
+	for _, test := range tests {
+		if cpe := FormatCPE(test.vendor, test.product, test.version); cpe != test.expected {
+			t.Errorf("wrong CPE for %q/%q/%q (got %s; expected %s)", test.vendor, test.product, test.version, cpe, test.expected)
+		}
+	}
+}
+
+func TestCPEFromURI(t *testing.T) {
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{"cpe:/a:openbsd:openssh:7.4", "cpe:2.3:a:openbsd:openssh:7.4:*:*:*:*:*:*:*"},
+		{"cpe:/a:igor_sysoev:nginx", "cpe:2.3:a:igor_sysoev:nginx:*:*:*:*:*:*:*:*"},
+		{"cpe:/o:linux:linux_kernel", "cpe:2.3:o:linux:linux_kernel:*:*:*:*:*:*:*:*"},
+		{"cpe:2.3:a:redis:redis", ""},
+	}
+	for _, test := range tests {
+		if cpe := CPEFromURI(test.uri); cpe != test.expected {
+			t.Errorf("wrong CPE for %s (got %s; expected %s)", test.uri, cpe, test.expected)
+		}
+	}
+}
+
+func TestIdentifyBanner(t *testing.T) {
+	patterns := []BannerPattern{
+		{Regexp: regexp.MustCompile(`ProFTPD (\d[\w.]*)`), Product: "ProFTPD", Vendor: "proftpd", CPEProduct: "proftpd"},
+		{Regexp: regexp.MustCompile(`Pure-FTPd`), Product: "Pure-FTPd", Vendor: "pureftpd", CPEProduct: "pure-ftpd"},
+		{Regexp: regexp.MustCompile(`Microsoft FTP Service`), Product: "Microsoft ftpd"},
+	}
+	tests := []struct {
+		banner     string
+		product    string
+		version    string
+		cpe        string
+		confidence int
+	}{
+		{"220 ProFTPD 1.3.5e Server (Debian) [::ffff:10.0.0.1]", "ProFTPD", "1.3.5e", "cpe:2.3:a:proftpd:proftpd:1.3.5e:*:*:*:*:*:*:*", 10},
+		{"220---------- Welcome to Pure-FTPd [privsep] [TLS] ----------", "Pure-FTPd", "", "cpe:2.3:a:pureftpd:pure-ftpd:*:*:*:*:*:*:*:*", 8},
+		{"220 Microsoft FTP Service", "Microsoft ftpd", "", "", 8},
+		{"220 Welcome", "", "", "", 0},
+	}
+	for _, test := range tests {
+		info := IdentifyBanner(test.banner, patterns)
+		if test.product == "" {
+			if info != nil {
+				t.Errorf("%q: unexpected service %+v", test.banner, info)
+			}
+			continue
+		}
+		if info == nil || info.Product != test.product || info.Version != test.version || info.CPE != test.cpe || info.Confidence != test.confidence {
+			t.Errorf("%q: got %+v", test.banner, info)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package zgrab2
+
+// Shard identifies the part of the targets scanned by this process, when
+// the targets are split between several processes with --shard and
+// --shards.
+type Shard struct {
+	Shard  int `json:"shard"`
+	Shards int `json:"shards"`
+}
+
+// GetShard returns the shard scanned by this process, or nil if the targets
+// are not sharded.
+func GetShard() *Shard {
+	if config.Shards <= 1 {
+		return nil
+	}
+	return &Shard{Shard: config.Shard, Shards: config.Shards}
+}
+
+// expansionIndex numbers the targets generated from the input, after CIDR
+// blocks and port ranges are expanded, in the order emitTargets generates
+// them without --randomize. Processes given the same input number the
+// targets alike, so each target goes to exactly one shard.
+var expansionIndex uint64
+
+// inShard reports whether the target with the given expansion index belongs
+// to the shard selected by --shard and --shards.
+func inShard(index uint64) bool {
+	return config.Shards <= 1 || index%uint64(config.Shards) == uint64(config.Shard)
+}
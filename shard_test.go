@@ -0,0 +1,65 @@
+package zgrab2
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestShards(t *testing.T) {
+	defer func(shard, shards int, randomize bool, seed int64, index uint64) {
+		config.Shard, config.Shards = shard, shards
+		config.Randomize, config.Seed = randomize, seed
+		expansionIndex = index
+	}(config.Shard, config.Shards, config.Randomize, config.Seed, expansionIndex)
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/29")
+	ports := PortList{{First: 80, Last: 81}, {First: 443, Last: 443}}
+
+	// collect expands the same input as each shard would.
+	collect := func(shard, shards int, randomize bool, seed int64) []string {
+		config.Shard, config.Shards = shard, shards
+		config.Randomize, config.Seed = randomize, seed
+		expansionIndex = 0
+		ch := make(chan ScanTarget, 64)
+		emitTargets(ipnet, ports, ScanTarget{}, ch)
+		emitTargets(nil, nil, ScanTarget{Domain: "example.com"}, ch)
+		close(ch)
+		var ret []string
+		for target := range ch {
+			ret = append(ret, target.String())
+		}
+		return ret
+	}
+	all := collect(0, 1, false, 0)
+	if len(all) != 25 {
+		t.Fatalf("expected 25 targets, got %d", len(all))
+	}
+	sort.Strings(all)
+
+	tests := []struct {
+		shards    int
+		randomize bool
+	}{
+		{shards: 2},
+		{shards: 3},
+		{shards: 7},
+		{shards: 30},
+		{shards: 3, randomize: true},
+	}
+	for _, test := range tests {
+		var union []string
+		for shard := 0; shard < test.shards; shard++ {
+			// Each shard gets its own seed, as separate processes would.
+			union = append(union, collect(shard, test.shards, test.randomize, int64(shard+1))...)
+		}
+		sort.Strings(union)
+		if !reflect.DeepEqual(union, all) {
+			t.Errorf("%d shards (randomize=%v): shards overlap or miss targets: %v", test.shards, test.randomize, union)
+		}
+	}
+
+	if a, b := collect(1, 3, false, 0), collect(1, 3, false, 0); !reflect.DeepEqual(a, b) {
+		t.Errorf("the same shard gave different targets: %v, %v", a, b)
+	}
+}
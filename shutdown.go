@@ -0,0 +1,95 @@
+package zgrab2
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// interrupted is closed by Interrupt.
+var interrupted = make(chan struct{})
+
+var interruptOnce sync.Once
+
+// abandoned is set if Process returned before every grab finished.
+var abandoned int32
+
+// Interrupt asks Process to shut down early: no further targets are read
+// from the input, the grabs in flight are given --shutdown-grace-period to
+// finish, and the results written so far are flushed. It is safe to call
+// more than once, and from any goroutine (e.g. a signal handler).
+func Interrupt() {
+	interruptOnce.Do(func() {
+		close(interrupted)
+	})
+}
+
+// Interrupted reports whether Interrupt has been called.
+func Interrupted() bool {
+	select {
+	case <-interrupted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Abandoned reports whether Process gave up on grabs that did not finish
+// within the grace period after an interrupt. Their workers may still be
+// running, so the Monitor must not be stopped.
+func Abandoned() bool {
+	return atomic.LoadInt32(&abandoned) != 0
+}
+
+// forwardTargets passes targets from in to out until in is closed or the
+// scan is interrupted, then closes out.
+func forwardTargets(in <-chan ScanTarget, out chan<- ScanTarget) {
+	defer close(out)
+	for {
+		select {
+		case <-interrupted:
+			return
+		case target, ok := <-in:
+			if !ok {
+				return
+			}
+			select {
+			case out <- target:
+				atomic.AddUint64(&counts.read, 1)
+			case <-interrupted:
+				return
+			}
+		}
+	}
+}
+
+// trackedResult is an encoded Grab along with the index of its target.
+type trackedResult struct {
+	index  uint64
+	result []byte
+}
+
+// forwardResults passes results from in to the output until in is closed or
+// stop is closed, then closes out. With checkpointing, out must be
+// unbuffered, so that the progress tracker knows which results have been
+// written.
+func forwardResults(in <-chan trackedResult, out chan<- []byte, stop <-chan struct{}) {
+	defer close(out)
+	for {
+		select {
+		case <-stop:
+			return
+		case r, ok := <-in:
+			if !ok {
+				return
+			}
+			select {
+			case out <- r.result:
+			case <-stop:
+				return
+			}
+			if progress != nil {
+				progress.forwarded(&r)
+			}
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package zgrab2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForwardResultsStop(t *testing.T) {
+	in := make(chan trackedResult)
+	out := make(chan []byte, 4)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		forwardResults(in, out, stop)
+		close(done)
+	}()
+	in <- trackedResult{index: 0, result: []byte("a")}
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("forwardResults did not return when stopped")
+	}
+	var results []string
+	for result := range out {
+		results = append(results, string(result))
+	}
+	if len(results) != 1 || results[0] != "a" {
+		t.Errorf("wrong results forwarded: %v", results)
+	}
+}
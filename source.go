@@ -0,0 +1,197 @@
+package zgrab2
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// maxSourceAddresses bounds the number of addresses --source-ip may list,
+// since CIDR blocks are expanded in memory.
+const maxSourceAddresses = 1 << 16
+
+// sourceAddresses are the local addresses that connections are made from,
+// with --source-ip and --source-port-range. A nil *sourceAddresses leaves
+// the choice to the operating system.
+type sourceAddresses struct {
+	ips4 []net.IP
+	ips6 []net.IP
+	// hash picks the address by a hash of the target's host, rather than in
+	// turn.
+	hash bool
+	next uint64
+
+	// firstPort and lastPort are the range of local ports for TCP, or zero
+	// if any port may be used.
+	firstPort uint16
+	lastPort  uint16
+	nextPort  uint64
+}
+
+// sources is nil unless --source-ip or --source-port-range is given.
+var sources *sourceAddresses
+
+// parseSourceIPs parses a comma-separated list of addresses and CIDR
+// blocks, and splits them by address family.
+func parseSourceIPs(spec string) (ips4 []net.IP, ips6 []net.IP, err error) {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		ipnet, err := parseNetwork(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		ones, bits := ipnet.Mask.Size()
+		if bits-ones > 16 || len(ips4)+len(ips6)+1<<uint(bits-ones) > maxSourceAddresses {
+			return nil, nil, fmt.Errorf("too many source addresses (the maximum is %d)", maxSourceAddresses)
+		}
+		for ip := ipnet.IP.Mask(ipnet.Mask); ipnet.Contains(ip); incrementIP(ip) {
+			if bits == net.IPv4len*8 {
+				ips4 = append(ips4, duplicateIP(ip))
+			} else {
+				ips6 = append(ips6, duplicateIP(ip))
+			}
+		}
+	}
+	return ips4, ips6, nil
+}
+
+// parsePortRange parses a range of ports of the form FIRST-LAST.
+func parsePortRange(spec string) (first uint16, last uint16, err error) {
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid port range %q, expected FIRST-LAST", spec)
+	}
+	a, errA := strconv.ParseUint(parts[0], 10, 16)
+	b, errB := strconv.ParseUint(parts[1], 10, 16)
+	if errA != nil || errB != nil || a == 0 || a > b {
+		return 0, 0, fmt.Errorf("invalid port range %q", spec)
+	}
+	return uint16(a), uint16(b), nil
+}
+
+// pick returns the local address for connections to host (an address or a
+// domain), or nil to let the operating system choose. A domain is
+// connected to from an IPv4 address when there are any.
+func (s *sourceAddresses) pick(host string) net.IP {
+	if s == nil {
+		return nil
+	}
+	ips := s.ips4
+	if ip := net.ParseIP(host); (ip != nil && ip.To4() == nil) || len(ips) == 0 {
+		ips = s.ips6
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+	var n uint64
+	if s.hash {
+		h := fnv.New32a()
+		h.Write([]byte(host))
+		n = uint64(h.Sum32())
+	} else {
+		n = atomic.AddUint64(&s.next, 1) - 1
+	}
+	return ips[n%uint64(len(ips))]
+}
+
+// tcpAddr returns the local address for a TCP connection from ip, with the
+// next port in the --source-port-range. It returns nil if neither is set.
+func (s *sourceAddresses) tcpAddr(ip net.IP) *net.TCPAddr {
+	if s == nil || (ip == nil && s.firstPort == 0) {
+		return nil
+	}
+	ret := &net.TCPAddr{IP: ip}
+	if s.firstPort != 0 {
+		n := atomic.AddUint64(&s.nextPort, 1) - 1
+		ret.Port = int(s.firstPort) + int(n%(uint64(s.lastPort-s.firstPort)+1))
+	}
+	return ret
+}
+
+// maxSourcePortTries bounds the ports of the --source-port-range that
+// dialFromSource tries for one connection.
+const maxSourcePortTries = 8
+
+// dialFromSource is dialNetwork for a dialer whose LocalAddr may hold a port
+// from the --source-port-range. The socket is bound with SO_REUSEADDR, so
+// that a port left in TIME_WAIT by an earlier connection (for about a
+// minute after it closes) can be used again. If the port still cannot be
+// used, as when the earlier connection was to the same remote address, the
+// next ports in the range are tried.
+func dialFromSource(ctx context.Context, d *net.Dialer, network, address string) (net.Conn, error) {
+	local, ok := d.LocalAddr.(*net.TCPAddr)
+	if !ok || local.Port == 0 {
+		return dialNetwork(ctx, d, network, address)
+	}
+	dialer := *d
+	control := d.Control
+	dialer.Control = func(network, address string, c syscall.RawConn) error {
+		var err error
+		if controlErr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+		}); controlErr != nil {
+			return controlErr
+		}
+		if err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+		if control != nil {
+			return control(network, address, c)
+		}
+		return nil
+	}
+	for try := 1; ; try++ {
+		conn, err := dialNetwork(ctx, &dialer, network, address)
+		if err == nil || try == maxSourcePortTries || !isSourcePortInUse(err) {
+			return conn, err
+		}
+		dialer.LocalAddr = sources.tcpAddr(local.IP)
+	}
+}
+
+// isSourcePortInUse reports whether err is a dial error caused by the local
+// port being in use.
+func isSourcePortInUse(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	errno := opErr.Err
+	if sysErr, ok := errno.(*os.SyscallError); ok {
+		errno = sysErr.Err
+	}
+	return errno == syscall.EADDRINUSE || errno == syscall.EADDRNOTAVAIL
+}
+
+// localAddr returns the local address for a connection from ip over the
+// given network, as a net.Dialer's LocalAddr, or nil if it need not be set.
+func localAddr(network string, ip net.IP) net.Addr {
+	if strings.HasPrefix(network, "tcp") {
+		if addr := sources.tcpAddr(ip); addr != nil {
+			return addr
+		}
+		return nil
+	}
+	if ip != nil && strings.HasPrefix(network, "udp") {
+		return &net.UDPAddr{IP: ip}
+	}
+	return nil
+}
+
+// hostOf returns the host part of a host:port address.
+func hostOf(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
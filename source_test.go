@@ -0,0 +1,149 @@
+package zgrab2
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseSourceIPs(t *testing.T) {
+	ips4, ips6, err := parseSourceIPs("10.0.0.1, 10.0.1.0/30,2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips4) != 5 || ips4[0].String() != "10.0.0.1" || ips4[4].String() != "10.0.1.3" {
+		t.Errorf("wrong IPv4 sources %v", ips4)
+	}
+	if len(ips6) != 1 || ips6[0].String() != "2001:db8::1" {
+		t.Errorf("wrong IPv6 sources %v", ips6)
+	}
+	for _, bad := range []string{"10.0.0.0/8", "10.0.0.256", "2001:db8::/64"} {
+		if _, _, err := parseSourceIPs(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestSourcePick(t *testing.T) {
+	s := &sourceAddresses{
+		ips4: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")},
+		ips6: []net.IP{net.ParseIP("2001:db8::1")},
+	}
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"192.0.2.1", "10.0.0.1"},
+		{"192.0.2.1", "10.0.0.2"},
+		{"example.com", "10.0.0.1"},
+		{"2001:db8::99", "2001:db8::1"},
+		// the turn is shared by both address families
+		{"192.0.2.2", "10.0.0.1"},
+	}
+	for _, test := range tests {
+		if got := s.pick(test.host).String(); got != test.expected {
+			t.Errorf("pick(%s) = %s, expected %s", test.host, got, test.expected)
+		}
+	}
+
+	s.hash = true
+	for _, host := range []string{"192.0.2.1", "192.0.2.2", "example.com"} {
+		if a, b := s.pick(host), s.pick(host); !a.Equal(b) {
+			t.Errorf("hashing %s gave %s, then %s", host, a, b)
+		}
+	}
+
+	if ip := (*sourceAddresses)(nil).pick("192.0.2.1"); ip != nil {
+		t.Errorf("expected no source, got %s", ip)
+	}
+	if ip := (&sourceAddresses{ips4: s.ips4}).pick("2001:db8::99"); ip != nil {
+		t.Errorf("expected no IPv6 source, got %s", ip)
+	}
+}
+
+func TestSourcePorts(t *testing.T) {
+	defer func(saved *sourceAddresses) {
+		sources = saved
+	}(sources)
+	first, last, err := parsePortRange("40000-40002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources = &sourceAddresses{firstPort: first, lastPort: last}
+	for _, expected := range []int{40000, 40001, 40002, 40000} {
+		addr, ok := localAddr("tcp", nil).(*net.TCPAddr)
+		if !ok || addr.Port != expected {
+			t.Errorf("expected local port %d, got %v", expected, addr)
+		}
+	}
+	if addr := localAddr("udp", nil); addr != nil {
+		t.Errorf("expected no local UDP address, got %v", addr)
+	}
+	for _, bad := range []string{"0-10", "10", "20-10", "1-65536"} {
+		if _, _, err := parsePortRange(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+
+	// A connection from the source address and port.
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer l.Close()
+	sources = &sourceAddresses{ips4: []net.IP{net.ParseIP("127.0.0.2").To4()}}
+	conn, err := DialTimeoutConnection("tcp", l.Addr().String(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if host := hostOf(conn.LocalAddr().String()); host != "127.0.0.2" {
+		t.Errorf("connected from %s", host)
+	}
+}
+
+func TestSourcePortReuse(t *testing.T) {
+	defer func(saved *sourceAddresses) {
+		sources = saved
+	}(sources)
+	listen := func() net.Listener {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					// Wait for the client to close first, leaving its port in
+					// TIME_WAIT.
+					conn.Read(make([]byte, 1))
+					conn.Close()
+				}()
+			}
+		}()
+		return l
+	}
+	a, b := listen(), listen()
+	defer a.Close()
+	defer b.Close()
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := uint16(free.Addr().(*net.TCPAddr).Port)
+	free.Close()
+	sources = &sourceAddresses{firstPort: port, lastPort: port}
+
+	for _, l := range []net.Listener{a, b} {
+		conn, err := DialTimeoutConnection("tcp", l.Addr().String(), time.Second, 0)
+		if err != nil {
+			t.Fatalf("could not dial from port %d again: %v", port, err)
+		}
+		if local := conn.LocalAddr().(*net.TCPAddr).Port; local != int(port) {
+			t.Errorf("dialed from port %d, expected %d", local, port)
+		}
+		conn.Close()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"io"
 	"net"
 	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/zmap/zcrypto/x509"
 )
 
 // ScanStatus is the enum value that states how the scan ended.
@@ -16,16 +20,52 @@ type ScanStatus string
 // TODO: lump connection closed / io timeout?
 // TODO: Add SCAN_TLS_PROTOCOL_ERROR? For purely TLS-wrapped protocols, SCAN_PROTOCOL_ERROR is fine -- but for protocols that have a non-TLS bootstrap (e.g. a STARTTLS procedure), SCAN_PROTOCOL_ERROR is misleading, since it did get far-enough into the application protocol to start TLS handshaking -- but a garbled TLS handshake is certainly not a SCAN_APPLICATION_ERROR
 const (
-	SCAN_SUCCESS                       = ScanStatus("success")             // The protocol in question was positively identified and the scan encountered no errors
-	SCAN_CONNECTION_REFUSED            = ScanStatus("connection-refused")  // TCP connection was actively rejected
-	SCAN_CONNECTION_TIMEOUT            = ScanStatus("connection-timeout")  // No response to TCP connection request
-	SCAN_CONNECTION_CLOSED             = ScanStatus("connection-closed")   // The TCP connection was unexpectedly closed
-	SCAN_IO_TIMEOUT                    = ScanStatus("io-timeout")          // Timed out waiting on data
-	SCAN_PROTOCOL_ERROR                = ScanStatus("protocol-error")      // Received data incompatible with the target protocol
-	SCAN_APPLICATION_ERROR             = ScanStatus("application-error")   // The application reported an error
-	SCAN_UNKNOWN_ERROR                 = ScanStatus("unknown-error")       // Catch-all for unrecognized errors
+	SCAN_SUCCESS               = ScanStatus("success")               // The protocol in question was positively identified and the scan encountered no errors
+	SCAN_CONNECTION_REFUSED    = ScanStatus("connection-refused")    // TCP connection was actively rejected
+	SCAN_CONNECTION_TIMEOUT    = ScanStatus("connection-timeout")    // No response to TCP connection request
+	SCAN_CONNECTION_CLOSED     = ScanStatus("connection-closed")     // The TCP connection was unexpectedly closed
+	SCAN_IO_TIMEOUT            = ScanStatus("io-timeout")            // Timed out waiting on data
+	SCAN_PROTOCOL_ERROR        = ScanStatus("protocol-error")        // Received data incompatible with the target protocol
+	SCAN_APPLICATION_ERROR     = ScanStatus("application-error")     // The application reported an error
+	SCAN_UNKNOWN_ERROR         = ScanStatus("unknown-error")         // Catch-all for unrecognized errors
+	SCAN_HOST_UNREACHABLE      = ScanStatus("host-unreachable")      // The host could not be reached (EHOSTUNREACH, EHOSTDOWN)
+	SCAN_NETWORK_UNREACHABLE   = ScanStatus("network-unreachable")   // The host's network could not be reached (ENETUNREACH, ENETDOWN)
+	SCAN_DNS_NOT_FOUND         = ScanStatus("dns-not-found")         // The domain does not exist (NXDOMAIN) or has no addresses
+	SCAN_DNS_ERROR             = ScanStatus("dns-error")             // The domain could not be looked up
+	SCAN_TLS_ALERT             = ScanStatus("tls-alert")             // The server ended the TLS handshake with an alert
+	SCAN_TLS_CERTIFICATE_ERROR = ScanStatus("tls-certificate-error") // The server's certificate failed verification
+	SCAN_READ_LIMIT_EXCEEDED   = ScanStatus("read-limit-exceeded")   // The server sent more data than the read limit
 )
 
+// scanStatuses lists every ScanStatus value.
+var scanStatuses = []ScanStatus{
+	SCAN_SUCCESS,
+	SCAN_CONNECTION_REFUSED,
+	SCAN_CONNECTION_TIMEOUT,
+	SCAN_CONNECTION_CLOSED,
+	SCAN_IO_TIMEOUT,
+	SCAN_PROTOCOL_ERROR,
+	SCAN_APPLICATION_ERROR,
+	SCAN_UNKNOWN_ERROR,
+	SCAN_HOST_UNREACHABLE,
+	SCAN_NETWORK_UNREACHABLE,
+	SCAN_DNS_NOT_FOUND,
+	SCAN_DNS_ERROR,
+	SCAN_TLS_ALERT,
+	SCAN_TLS_CERTIFICATE_ERROR,
+	SCAN_READ_LIMIT_EXCEEDED,
+}
+
+// isScanStatus reports whether status is one of the ScanStatus values.
+func isScanStatus(status ScanStatus) bool {
+	for _, s := range scanStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
 // ScanError an error that also includes a ScanStatus.
 type ScanError struct {
 	Status ScanStatus
@@ -58,38 +98,147 @@ func DetectScanError(err error) *ScanError {
 // Mostly supports network errors. A nil error is interpreted as SCAN_SUCCESS.
 // An unrecognized error is interpreted as SCAN_UNKNOWN_ERROR.
 func TryGetScanStatus(err error) ScanStatus {
-	if err == nil {
-		return SCAN_SUCCESS
-	}
-	if err == io.EOF {
-		// Presumably the caller did not call TryGetScanStatus if the EOF was expected
+	status, _ := classifyError(err)
+	return status
+}
+
+// TryGetErrorType returns a short name for the cause of the given error,
+// finer than its ScanStatus: the system error (such as "ECONNREFUSED"),
+// "timeout", "eof", "dns-not-found", the TLS alert (such as
+// "tls-alert-handshake-failure"), the certificate problem, and so on. It
+// returns "" if the cause is not recognized.
+func TryGetErrorType(err error) string {
+	_, errorType := classifyError(err)
+	return errorType
+}
+
+// errnoClass is the ScanStatus and name of a system error. An empty status
+// means the status depends on the operation that failed.
+type errnoClass struct {
+	status ScanStatus
+	name   string
+}
+
+var errnoClasses = map[syscall.Errno]errnoClass{
+	syscall.ECONNREFUSED:  {SCAN_CONNECTION_REFUSED, "ECONNREFUSED"},
+	syscall.ECONNRESET:    {SCAN_CONNECTION_CLOSED, "ECONNRESET"},
+	syscall.ECONNABORTED:  {SCAN_CONNECTION_CLOSED, "ECONNABORTED"},
+	syscall.EPIPE:         {SCAN_CONNECTION_CLOSED, "EPIPE"},
+	syscall.EHOSTUNREACH:  {SCAN_HOST_UNREACHABLE, "EHOSTUNREACH"},
+	syscall.EHOSTDOWN:     {SCAN_HOST_UNREACHABLE, "EHOSTDOWN"},
+	syscall.ENETUNREACH:   {SCAN_NETWORK_UNREACHABLE, "ENETUNREACH"},
+	syscall.ENETDOWN:      {SCAN_NETWORK_UNREACHABLE, "ENETDOWN"},
+	syscall.ETIMEDOUT:     {"", "ETIMEDOUT"},
+	syscall.EADDRNOTAVAIL: {"", "EADDRNOTAVAIL"},
+	syscall.EACCES:        {"", "EACCES"},
+	syscall.EPERM:         {"", "EPERM"},
+}
+
+// opStatus is the ScanStatus of a failed network operation whose cause is
+// not recognized.
+func opStatus(op string) ScanStatus {
+	switch op {
+	case "dial":
+		// Windows examples:
+		//	"dial tcp 192.168.30.3:22: connectex: A connection attempt failed because the connected party did not properly respond after a period of time, or established connection failed because connected host has failed to respond."
+		//	"dial tcp 127.0.0.1:22: connectex: No connection could be made because the target machine actively refused it."
+		return SCAN_CONNECTION_TIMEOUT
+	case "read", "write":
 		return SCAN_IO_TIMEOUT
-	}
-	switch e := err.(type) {
-	case *ScanError:
-		return e.Status
-	case *net.OpError:
-		switch e.Op {
-		case "dial":
-			// TODO: Distinguish connection timeout / connection refused
-			// Windows examples:
-			//	"dial tcp 192.168.30.3:22: connectex: A connection attempt failed because the connected party did not properly respond after a period of time, or established connection failed because connected host has failed to respond."
-			//	"dial tcp 127.0.0.1:22: connectex: No connection could be made because the target machine actively refused it."
-			return SCAN_CONNECTION_TIMEOUT
-		case "read":
-			// TODO: Distinguish connection reset vs timeout
-			return SCAN_IO_TIMEOUT
-		case "write":
-			// TODO: Distinguish connection reset vs timeout
-			return SCAN_IO_TIMEOUT
-		default:
-			// TODO: Do we need a generic network error?
-			log.Debugf("Failed to detect error from net.OpError %v, op = %s at %s", e, e.Op, string(debug.Stack()))
-			return SCAN_UNKNOWN_ERROR
-		}
-	// TODO: More error types
 	default:
-		log.Debugf("Failed to detect error from %v at %s", e, string(debug.Stack()))
 		return SCAN_UNKNOWN_ERROR
 	}
 }
+
+// hyphenate turns a message like "handshake failure" into
+// "handshake-failure".
+func hyphenate(s string) string {
+	return strings.Replace(strings.TrimSpace(s), " ", "-", -1)
+}
+
+// classifyError returns the ScanStatus and the error type of err, looking
+// through the errors it wraps.
+func classifyError(err error) (ScanStatus, string) {
+	if err == nil {
+		return SCAN_SUCCESS, ""
+	}
+	original := err
+	// op is the outermost network operation that failed.
+	op := ""
+	for err != nil {
+		switch e := err.(type) {
+		case *ScanError:
+			var errorType string
+			if e.Err != nil {
+				_, errorType = classifyError(e.Err)
+			}
+			return e.Status, errorType
+		case *net.OpError:
+			if e.Op == "remote error" {
+				// zcrypto reports the alerts sent by the server this way.
+				return SCAN_TLS_ALERT, "tls-alert-" + hyphenate(e.Err.Error())
+			}
+			if op == "" {
+				op = e.Op
+			}
+		case *net.DNSError:
+			if e.IsNotFound {
+				return SCAN_DNS_NOT_FOUND, "dns-not-found"
+			}
+			if e.IsTimeout {
+				return SCAN_DNS_ERROR, "dns-timeout"
+			}
+			return SCAN_DNS_ERROR, "dns-error"
+		case syscall.Errno:
+			class, ok := errnoClasses[e]
+			if !ok {
+				class.name = "errno-" + strconv.Itoa(int(e))
+			}
+			if class.status == "" {
+				class.status = opStatus(op)
+			}
+			return class.status, class.name
+		case x509.UnknownAuthorityError, *x509.UnknownAuthorityError:
+			return SCAN_TLS_CERTIFICATE_ERROR, "certificate-unknown-authority"
+		case x509.HostnameError, *x509.HostnameError:
+			return SCAN_TLS_CERTIFICATE_ERROR, "certificate-hostname-mismatch"
+		case x509.CertificateInvalidError, *x509.CertificateInvalidError:
+			return SCAN_TLS_CERTIFICATE_ERROR, "certificate-invalid"
+		}
+		if err == ErrAddressExcluded {
+			return SCAN_UNKNOWN_ERROR, "address-excluded"
+		}
+		if err == ErrReadLimitExceeded {
+			return SCAN_READ_LIMIT_EXCEEDED, "read-limit-exceeded"
+		}
+		if err == io.EOF {
+			// Presumably the caller did not call TryGetScanStatus if the EOF was expected
+			return SCAN_IO_TIMEOUT, "eof"
+		}
+		if e, ok := err.(*net.OpError); ok {
+			err = e.Err
+			continue
+		}
+		if u, ok := err.(interface{ Unwrap() error }); ok && u.Unwrap() != nil {
+			err = u.Unwrap()
+			continue
+		}
+		// Wrappers report the timeouts of the errors they wrap, so only the
+		// innermost error is checked.
+		if t, ok := err.(timeoutError); ok && t.Timeout() {
+			if op == "dial" {
+				return SCAN_CONNECTION_TIMEOUT, "timeout"
+			}
+			return SCAN_IO_TIMEOUT, "timeout"
+		}
+		if strings.HasPrefix(err.Error(), "tls: failed to parse certificate") {
+			return SCAN_TLS_CERTIFICATE_ERROR, "certificate-unparsable"
+		}
+		break
+	}
+	if status := opStatus(op); status != SCAN_UNKNOWN_ERROR {
+		return status, ""
+	}
+	log.Debugf("Failed to detect error from %v at %s", original, string(debug.Stack()))
+	return SCAN_UNKNOWN_ERROR, ""
+}
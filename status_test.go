@@ -0,0 +1,90 @@
+package zgrab2
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/zmap/zcrypto/x509"
+)
+
+// fakeTimeout is an error that reports being a timeout.
+type fakeTimeout struct{}
+
+func (fakeTimeout) Error() string   { return "i/o timeout" }
+func (fakeTimeout) Timeout() bool   { return true }
+func (fakeTimeout) Temporary() bool { return true }
+
+// opError returns a net.OpError for op failing with errno, as the net
+// package reports it.
+func opError(op string, errno syscall.Errno) error {
+	return &net.OpError{Op: op, Net: "tcp", Err: os.NewSyscallError("connect", errno)}
+}
+
+func TestTryGetScanStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		status    ScanStatus
+		errorType string
+	}{
+		{"nil", nil, SCAN_SUCCESS, ""},
+		{"eof", io.EOF, SCAN_IO_TIMEOUT, "eof"},
+		{"refused", opError("dial", syscall.ECONNREFUSED), SCAN_CONNECTION_REFUSED, "ECONNREFUSED"},
+		{"host unreachable", opError("dial", syscall.EHOSTUNREACH), SCAN_HOST_UNREACHABLE, "EHOSTUNREACH"},
+		{"host down", opError("dial", syscall.EHOSTDOWN), SCAN_HOST_UNREACHABLE, "EHOSTDOWN"},
+		{"network unreachable", opError("dial", syscall.ENETUNREACH), SCAN_NETWORK_UNREACHABLE, "ENETUNREACH"},
+		{"dial timedout", opError("dial", syscall.ETIMEDOUT), SCAN_CONNECTION_TIMEOUT, "ETIMEDOUT"},
+		{"read timedout", opError("read", syscall.ETIMEDOUT), SCAN_IO_TIMEOUT, "ETIMEDOUT"},
+		{"reset", opError("read", syscall.ECONNRESET), SCAN_CONNECTION_CLOSED, "ECONNRESET"},
+		{"broken pipe", opError("write", syscall.EPIPE), SCAN_CONNECTION_CLOSED, "EPIPE"},
+		{"other errno", opError("read", syscall.Errno(200)), SCAN_IO_TIMEOUT, "errno-200"},
+		{"dial timeout", &net.OpError{Op: "dial", Err: fakeTimeout{}}, SCAN_CONNECTION_TIMEOUT, "timeout"},
+		{"read timeout", &net.OpError{Op: "read", Err: fakeTimeout{}}, SCAN_IO_TIMEOUT, "timeout"},
+		{"dial unknown", &net.OpError{Op: "dial", Err: errors.New("no route")}, SCAN_CONNECTION_TIMEOUT, ""},
+		{"nxdomain", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}}, SCAN_DNS_NOT_FOUND, "dns-not-found"},
+		{"dns timeout", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}, SCAN_DNS_ERROR, "dns-timeout"},
+		{"dns failure", &net.DNSError{Err: "server misbehaving"}, SCAN_DNS_ERROR, "dns-error"},
+		{"tls alert", &net.OpError{Op: "remote error", Err: errors.New("handshake failure")}, SCAN_TLS_ALERT, "tls-alert-handshake-failure"},
+		{"unknown authority", x509.UnknownAuthorityError{}, SCAN_TLS_CERTIFICATE_ERROR, "certificate-unknown-authority"},
+		{"hostname", x509.HostnameError{Host: "example.com"}, SCAN_TLS_CERTIFICATE_ERROR, "certificate-hostname-mismatch"},
+		{"invalid certificate", x509.CertificateInvalidError{Reason: x509.Expired}, SCAN_TLS_CERTIFICATE_ERROR, "certificate-invalid"},
+		{"unparsable certificate", errors.New("tls: failed to parse certificate from server: asn1: syntax error"), SCAN_TLS_CERTIFICATE_ERROR, "certificate-unparsable"},
+		{"read limit", ErrReadLimitExceeded, SCAN_READ_LIMIT_EXCEEDED, "read-limit-exceeded"},
+		{"scan error", NewScanError(SCAN_PROTOCOL_ERROR, io.EOF), SCAN_PROTOCOL_ERROR, "eof"},
+		{"url error", &url.Error{Op: "Get", URL: "http://10.0.0.1/", Err: opError("dial", syscall.ECONNREFUSED)}, SCAN_CONNECTION_REFUSED, "ECONNREFUSED"},
+		{"unknown", errors.New("something else"), SCAN_UNKNOWN_ERROR, ""},
+	}
+	for _, test := range tests {
+		if status := TryGetScanStatus(test.err); status != test.status {
+			t.Errorf("%s: got status %s, expected %s", test.name, status, test.status)
+		}
+		if errorType := TryGetErrorType(test.err); errorType != test.errorType {
+			t.Errorf("%s: got error type %q, expected %q", test.name, errorType, test.errorType)
+		}
+	}
+	for _, status := range []ScanStatus{SCAN_HOST_UNREACHABLE, SCAN_DNS_NOT_FOUND, SCAN_TLS_ALERT, SCAN_READ_LIMIT_EXCEEDED} {
+		if !isScanStatus(status) {
+			t.Errorf("%s is missing from scanStatuses", status)
+		}
+	}
+}
+
+func TestTryGetScanStatusDial(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing listens on the port once it is closed.
+	address := l.Addr().String()
+	l.Close()
+	_, err = DialTimeoutConnection("tcp", address, time.Second, 0)
+	if status := TryGetScanStatus(err); status != SCAN_CONNECTION_REFUSED {
+		t.Errorf("got status %s for %v", status, err)
+	}
+}
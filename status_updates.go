@@ -0,0 +1,142 @@
+package zgrab2
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StatusUpdate is the line written to the metadata file every
+// --status-updates-interval while the scan runs.
+type StatusUpdate struct {
+	Time string `json:"time"`
+	// Elapsed is the time since the scan started, in seconds.
+	Elapsed float64 `json:"elapsed"`
+
+	// Read is the number of targets read from the input, after CIDR blocks
+	// and port lists are expanded but before --resolve and --ports, which
+	// may turn each into several. Completed is the number whose grabs have
+	// finished, and InFlight the number being grabbed, both counted after
+	// --resolve and --ports, so that Completed may exceed Read.
+	Read      uint64 `json:"read"`
+	Completed uint64 `json:"completed"`
+	InFlight  uint64 `json:"in_flight"`
+
+	// Rate is the number of targets completed per second since the
+	// previous update.
+	Rate float64 `json:"rate"`
+
+	// Progress is the fraction of the input read, and ETA the estimated
+	// number of seconds left. Both are only known when the input is a
+	// regular file in which each line is a single target: they are left
+	// out once a line expands to several targets (a CIDR block or a port
+	// list), or with --resolve or --ports.
+	Progress *float64 `json:"progress,omitempty"`
+	ETA      *float64 `json:"eta,omitempty"`
+
+	// Statuses counts the scans of each module by their status.
+	Statuses map[string]map[ScanStatus]uint64 `json:"statuses"`
+}
+
+// targetCounts follows the targets through the scan, for the status
+// updates.
+type targetCounts struct {
+	read      uint64
+	started   uint64
+	completed uint64
+	// expanded is set once an input line expands to several targets.
+	expanded uint32
+}
+
+var counts targetCounts
+
+// statusReporter produces the status updates of a scan.
+type statusReporter struct {
+	mon   *Monitor
+	input *os.File
+	start time.Time
+
+	// last and lastCompleted are the time and count of the previous update.
+	last          time.Time
+	lastCompleted uint64
+}
+
+func newStatusReporter(mon *Monitor, input *os.File, start time.Time) *statusReporter {
+	return &statusReporter{mon: mon, input: input, start: start, last: start}
+}
+
+// inputProgress returns the fraction of the input file read so far, or
+// false if the input is not a regular file, or the fraction does not tell
+// how many targets are left because the targets were expanded.
+func (r *statusReporter) inputProgress() (float64, bool) {
+	if r.input == nil || config.Resolve || config.Ports != "" || atomic.LoadUint32(&counts.expanded) != 0 {
+		return 0, false
+	}
+	info, err := r.input.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return 0, false
+	}
+	offset, err := r.input.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+	if offset > info.Size() {
+		offset = info.Size()
+	}
+	return float64(offset) / float64(info.Size()), true
+}
+
+// update returns the status of the scan at now.
+func (r *statusReporter) update(now time.Time) *StatusUpdate {
+	completed := atomic.LoadUint64(&counts.completed)
+	ret := &StatusUpdate{
+		Time:      now.Format(time.RFC3339),
+		Elapsed:   now.Sub(r.start).Seconds(),
+		Read:      atomic.LoadUint64(&counts.read),
+		Completed: completed,
+		InFlight:  atomic.LoadUint64(&counts.started) - completed,
+		Statuses:  make(map[string]map[ScanStatus]uint64),
+	}
+	if interval := now.Sub(r.last).Seconds(); interval > 0 {
+		ret.Rate = float64(completed-r.lastCompleted) / interval
+	}
+	r.last, r.lastCompleted = now, completed
+	if progress, ok := r.inputProgress(); ok {
+		ret.Progress = &progress
+		if progress > 0 {
+			eta := ret.Elapsed * (1 - progress) / progress
+			ret.ETA = &eta
+		}
+	}
+	if r.mon != nil {
+		for name, byStatus := range r.mon.GetMetrics() {
+			ret.Statuses[name] = make(map[ScanStatus]uint64, len(byStatus))
+			for status, metrics := range byStatus {
+				ret.Statuses[name][status] = metrics.Scans
+			}
+		}
+	}
+	return ret
+}
+
+// writeStatusUpdates writes a status update to w every interval until stop
+// is closed.
+func (r *statusReporter) writeStatusUpdates(w io.Writer, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := enc.Encode(r.update(now)); err != nil {
+				log.Errorf("could not write status update: %s", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
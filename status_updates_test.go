@@ -0,0 +1,104 @@
+package zgrab2
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatusUpdate(t *testing.T) {
+	defer func(saved targetCounts) {
+		counts = saved
+	}(counts)
+	input, err := ioutil.TempFile("", "zgrab2-input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(input.Name())
+	defer input.Close()
+	input.WriteString(strings.Repeat("10.0.0.1\n", 100))
+
+	var wg sync.WaitGroup
+	mon := MakeMonitor(16, &wg)
+	s := &flakyScanner{fakeScanner: fakeScanner{name: "flaky"}, statuses: []ScanStatus{SCAN_IO_TIMEOUT}}
+	runScanner(s, nil, mon, ScanTarget{})
+	runScanner(s, nil, mon, ScanTarget{})
+	mon.Stop()
+	wg.Wait()
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := newStatusReporter(mon, input, start)
+	tests := []struct {
+		offset    int64
+		read      uint64
+		started   uint64
+		completed uint64
+		at        time.Duration
+		inFlight  uint64
+		rate      float64
+		progress  float64
+		eta       float64
+	}{
+		{offset: 225, read: 25, started: 20, completed: 10, at: 10 * time.Second, inFlight: 10, rate: 1, progress: 0.25, eta: 30},
+		{offset: 450, read: 50, started: 45, completed: 40, at: 20 * time.Second, inFlight: 5, rate: 3, progress: 0.5, eta: 20},
+		{offset: 900, read: 100, started: 100, completed: 100, at: 30 * time.Second, inFlight: 0, rate: 6, progress: 1, eta: 0},
+	}
+	for i, test := range tests {
+		input.Seek(test.offset, os.SEEK_SET)
+		counts = targetCounts{read: test.read, started: test.started, completed: test.completed}
+		update := r.update(start.Add(test.at))
+		if update.Read != test.read || update.Completed != test.completed || update.InFlight != test.inFlight || update.Rate != test.rate {
+			t.Errorf("%d: wrong counts %+v", i, update)
+		}
+		if update.Progress == nil || *update.Progress != test.progress || update.ETA == nil || *update.ETA != test.eta {
+			t.Errorf("%d: wrong progress %v and ETA %v", i, update.Progress, update.ETA)
+		}
+		if update.Statuses["flaky"][SCAN_IO_TIMEOUT] != 1 || update.Statuses["flaky"][SCAN_SUCCESS] != 1 {
+			t.Errorf("%d: wrong statuses %v", i, update.Statuses)
+		}
+	}
+
+	// Once a line expands to several targets, the offset no longer tells
+	// how many are left.
+	ch := make(chan ScanTarget, 4)
+	_, ipnet, _ := net.ParseCIDR("10.0.0.0/30")
+	emitTargets(ipnet, nil, ScanTarget{}, ch)
+	if update := r.update(start.Add(40 * time.Second)); update.Progress != nil || update.ETA != nil {
+		t.Errorf("unexpected progress %v and ETA %v after a CIDR block", update.Progress, update.ETA)
+	}
+
+	// Without a regular file, the progress is unknown.
+	update := newStatusReporter(nil, nil, start).update(start.Add(time.Second))
+	if update.Progress != nil || update.ETA != nil {
+		t.Errorf("unexpected progress %v and ETA %v", update.Progress, update.ETA)
+	}
+}
+
+func TestWriteStatusUpdates(t *testing.T) {
+	var buf bytes.Buffer
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		newStatusReporter(nil, nil, time.Now()).writeStatusUpdates(&buf, 10*time.Millisecond, stop)
+		close(done)
+	}()
+	time.Sleep(35 * time.Millisecond)
+	close(stop)
+	<-done
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("expected several updates, got %q", buf.String())
+	}
+	for _, line := range lines {
+		var update StatusUpdate
+		if err := json.Unmarshal([]byte(line), &update); err != nil || update.Time == "" {
+			t.Errorf("invalid update %q: %v", line, err)
+		}
+	}
+}
@@ -269,6 +269,8 @@ type TLSConnection struct {
 	tls.Conn
 	flags *TLSFlags
 	log   *TLSLog
+	// raw is the connection the TLS session runs over.
+	raw net.Conn
 }
 
 type TLSLog struct {
@@ -288,6 +290,11 @@ func (z *TLSConnection) GetLog() *TLSLog {
 
 func (z *TLSConnection) Handshake() error {
 	log := z.GetLog()
+	if raw, ok := z.raw.(*TimeoutConnection); ok {
+		defer func(start time.Time) {
+			raw.tlsDuration += time.Since(start)
+		}(time.Now())
+	}
 	if z.flags.Heartbleed {
 		buf := make([]byte, 256)
 		defer func() {
@@ -342,6 +349,7 @@ func (t *TLSFlags) GetWrappedConnection(conn net.Conn, cfg *tls.Config) *TLSConn
 	wrappedClient := TLSConnection{
 		Conn:  *tlsClient,
 		flags: t,
+		raw:   conn,
 	}
 	return &wrappedClient
 }
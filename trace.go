@@ -0,0 +1,179 @@
+package zgrab2
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// scanTrace collects the connections made by a single scan, for the
+// metrics and the connection block of the response. A nil *scanTrace
+// collects nothing.
+type scanTrace struct {
+	mutex sync.Mutex
+	conns []*TimeoutConnection
+}
+
+// connectionStats are the measurements of a single connection.
+type connectionStats struct {
+	// connect is how long the connection took to establish, and firstByte
+	// how long after that the first byte arrived (zero if none did).
+	connect      time.Duration
+	firstByte    time.Duration
+	tls          time.Duration
+	bytesRead    uint64
+	bytesWritten uint64
+	truncated    bool
+
+	// start is when the connection was attempted, and end when it was
+	// closed (or now, if it is still open).
+	start time.Time
+	end   time.Time
+
+	local  net.Addr
+	remote net.Addr
+}
+
+func (t *scanTrace) add(conn *TimeoutConnection) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.conns = append(t.conns, conn)
+}
+
+// count returns the number of connections made so far.
+func (t *scanTrace) count() int {
+	if t == nil {
+		return 0
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.conns)
+}
+
+// stats returns the measurements of each connection made so far.
+func (t *scanTrace) stats() []connectionStats {
+	if t == nil {
+		return nil
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	ret := make([]connectionStats, len(t.conns))
+	for i, conn := range t.conns {
+		ret[i] = connectionStats{
+			connect:      conn.dialDuration,
+			firstByte:    conn.firstByte,
+			tls:          conn.tlsDuration,
+			bytesRead:    uint64(conn.BytesRead),
+			bytesWritten: uint64(conn.BytesWritten),
+			truncated:    conn.truncated,
+			start:        conn.connected.Add(-conn.dialDuration),
+			end:          conn.closedAt,
+			local:        conn.LocalAddr(),
+			remote:       conn.RemoteAddr(),
+		}
+		if ret[i].end.IsZero() {
+			ret[i].end = now
+		}
+	}
+	return ret
+}
+
+// TrackConnection counts a connection towards the statistics of the scan of
+// the target. Connections opened with the ScanTarget's methods are counted
+// already; modules that dial for themselves (with a Dialer, for instance)
+// should pass their connections here. Connections that were not dialed by
+// ZGrab2 are ignored.
+func (target *ScanTarget) TrackConnection(conn net.Conn) {
+	if tc, ok := conn.(*TimeoutConnection); ok {
+		target.trace.add(tc)
+	}
+}
+
+// ConnectionInfo describes the connections made by a scan, with
+// --connection-info. When a scan makes several connections, the addresses
+// are those of the first, and the durations and byte counts are summed.
+type ConnectionInfo struct {
+	LocalAddress  string `json:"local_address,omitempty"`
+	RemoteAddress string `json:"remote_address,omitempty"`
+
+	// ResolvedIP is the address of the target that was connected to, which
+	// is not known for domains reached through a proxy.
+	ResolvedIP string `json:"resolved_ip,omitempty"`
+	Port       uint   `json:"port,omitempty"`
+
+	Connections int `json:"connections"`
+
+	// The durations, in seconds. DNS is the --resolve lookup of the
+	// target's domain; lookups made while connecting are part of Connect.
+	// FirstByte is from the first connection that read any data. Total is
+	// from the start of the first connection to the close of the last.
+	DNS       float64 `json:"dns,omitempty"`
+	Connect   float64 `json:"connect"`
+	TLS       float64 `json:"tls,omitempty"`
+	FirstByte float64 `json:"first_byte,omitempty"`
+	Total     float64 `json:"total"`
+
+	BytesRead    uint64 `json:"bytes_read"`
+	BytesWritten uint64 `json:"bytes_written"`
+
+	// Truncated is set if a read was cut short by the read limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// connectionInfo aggregates the connections made to target, or returns nil
+// if there were none.
+func connectionInfo(target *ScanTarget, conns []connectionStats) *ConnectionInfo {
+	if len(conns) == 0 {
+		return nil
+	}
+	ret := &ConnectionInfo{Connections: len(conns)}
+	if target.resolution != nil {
+		ret.DNS = target.resolution.duration.Seconds()
+	}
+	first := conns[0]
+	if first.local != nil {
+		ret.LocalAddress = first.local.String()
+	}
+	if first.remote != nil {
+		ret.RemoteAddress = first.remote.String()
+	}
+	if target.IP != nil {
+		ret.ResolvedIP = target.IP.String()
+	} else if len(proxies) == 0 && first.remote != nil {
+		if host, _, err := net.SplitHostPort(first.remote.String()); err == nil {
+			ret.ResolvedIP = host
+		}
+	}
+	if target.Port != nil {
+		ret.Port = *target.Port
+	} else if first.remote != nil && len(proxies) == 0 {
+		if _, port, err := net.SplitHostPort(first.remote.String()); err == nil {
+			p, _ := strconv.ParseUint(port, 10, 16)
+			ret.Port = uint(p)
+		}
+	}
+	start, end := first.start, first.end
+	for _, c := range conns {
+		ret.Connect += c.connect.Seconds()
+		ret.TLS += c.tls.Seconds()
+		if ret.FirstByte == 0 && c.firstByte > 0 {
+			ret.FirstByte = c.firstByte.Seconds()
+		}
+		ret.BytesRead += c.bytesRead
+		ret.BytesWritten += c.bytesWritten
+		ret.Truncated = ret.Truncated || c.truncated
+		if c.start.Before(start) {
+			start = c.start
+		}
+		if c.end.After(end) {
+			end = c.end
+		}
+	}
+	ret.Total = end.Sub(start).Seconds()
+	return ret
+}
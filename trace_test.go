@@ -0,0 +1,113 @@
+package zgrab2
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnectionInfo(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	local := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 40000}
+	remote := &net.TCPAddr{IP: net.ParseIP("198.51.100.7"), Port: 443}
+	port := uint(8443)
+	tests := []struct {
+		name     string
+		target   ScanTarget
+		conns    []connectionStats
+		expected *ConnectionInfo
+	}{
+		{name: "none"},
+		{
+			name:   "single",
+			target: ScanTarget{Domain: "example.com", resolution: &Resolution{duration: 250 * time.Millisecond}},
+			conns: []connectionStats{
+				{connect: time.Second, firstByte: 500 * time.Millisecond, tls: 2 * time.Second, bytesRead: 100, bytesWritten: 10, start: start, end: start.Add(4 * time.Second), local: local, remote: remote},
+			},
+			expected: &ConnectionInfo{
+				LocalAddress: "192.0.2.1:40000", RemoteAddress: "198.51.100.7:443", ResolvedIP: "198.51.100.7", Port: 443,
+				Connections: 1, DNS: 0.25, Connect: 1, TLS: 2, FirstByte: 0.5, Total: 4, BytesRead: 100, BytesWritten: 10,
+			},
+		},
+		{
+			name:   "several",
+			target: ScanTarget{IP: net.ParseIP("203.0.113.9"), Port: &port},
+			conns: []connectionStats{
+				{connect: time.Second, bytesWritten: 5, start: start.Add(time.Second), end: start.Add(2 * time.Second), local: local, remote: remote},
+				{connect: 2 * time.Second, firstByte: time.Second, bytesRead: 7, bytesWritten: 5, truncated: true, start: start, end: start.Add(8 * time.Second)},
+			},
+			expected: &ConnectionInfo{
+				LocalAddress: "192.0.2.1:40000", RemoteAddress: "198.51.100.7:443", ResolvedIP: "203.0.113.9", Port: 8443,
+				Connections: 2, Connect: 3, FirstByte: 1, Total: 8, BytesRead: 7, BytesWritten: 10, Truncated: true,
+			},
+		},
+	}
+	for _, test := range tests {
+		info := connectionInfo(&test.target, test.conns)
+		if (info == nil) != (test.expected == nil) || (info != nil && *info != *test.expected) {
+			t.Errorf("%s: got %+v, expected %+v", test.name, info, test.expected)
+		}
+	}
+}
+
+func TestTimeoutConnectionTruncated(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		server.Write([]byte("0123456789"))
+		server.Close()
+	}()
+	conn := NewTimeoutConnection(nil, client, time.Second, 0, 0, 4)
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.truncated || conn.BytesRead != 4 {
+		t.Errorf("got %d bytes, truncated %v", conn.BytesRead, conn.truncated)
+	}
+}
+
+func TestRunScannerConnectionInfo(t *testing.T) {
+	defer func(saved bool) {
+		config.ConnectionInfo = saved
+	}(config.ConnectionInfo)
+	config.ConnectionInfo = true
+	echo, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer echo.Close()
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	port := uint(echo.Addr().(*net.TCPAddr).Port)
+
+	var wg sync.WaitGroup
+	mon := MakeMonitor(16, &wg)
+	defer mon.Stop()
+	s := &echoScanner{fakeScanner: fakeScanner{name: "echo"}, flags: &BaseFlags{Port: port, Timeout: time.Second}}
+	_, res := runScanner(s, s.flags, mon, ScanTarget{IP: net.ParseIP("127.0.0.1")})
+	info := res.Connection
+	if info == nil {
+		t.Fatal("no connection info")
+	}
+	if info.RemoteAddress != echo.Addr().String() || info.ResolvedIP != "127.0.0.1" || info.Port != port || info.Connections != 1 {
+		t.Errorf("wrong addresses %+v", info)
+	}
+	if info.BytesRead != 5 || info.BytesWritten != 5 || info.Truncated || info.Total < info.Connect {
+		t.Errorf("wrong measurements %+v", info)
+	}
+
+	_, res = runScanner(&fakeScanner{name: "none"}, nil, mon, ScanTarget{})
+	if res.Connection != nil {
+		t.Errorf("unexpected connection info %+v", res.Connection)
+	}
+}
@@ -11,7 +11,19 @@ from . import zgrab2
 banner_scan_response = SubRecord({
     "result": SubRecord({
         "banner": String(),
-        "length": Unsigned32BitInteger()
+        "length": Unsigned32BitInteger(),
+        "match": SubRecord({
+            "probe": String(),
+            "service": String(),
+            "softmatch": Boolean(),
+            "product": String(),
+            "version": String(),
+            "info": String(),
+            "hostname": String(),
+            "os": String(),
+            "device_type": String(),
+            "cpe": ListOf(String()),
+        }),
     })
 }, extends=zgrab2.base_scan_response)
 
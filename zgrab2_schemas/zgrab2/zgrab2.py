@@ -32,6 +32,11 @@ grab_result = Record({
     # TODO: ip may be required; see https://github.com/zmap/zgrab2/issues/104
     "ip": IPv4Address(required=False, doc="The IP address of the target."),
     "domain": String(required=False, doc="The domain name of the target, if available."),
+    "port": Unsigned16BitInteger(required=False, doc="The port of the target, if given in the input."),
+    "resolution": SubRecord({
+        "addresses": ListOf(String(), doc="The addresses found for the domain."),
+        "error": String(required=False, doc="The DNS error, if the lookup failed."),
+    }, required=False, doc="The DNS lookup of the domain, with --resolve."),
     "data": SubRecord(scan_response_types, doc="The scan data for this host."),
 })
 
@@ -45,6 +50,13 @@ STATUS_VALUES = [
   "protocol-error",
   "application-error",
   "unknown-error",
+  "host-unreachable",
+  "network-unreachable",
+  "dns-not-found",
+  "dns-error",
+  "tls-alert",
+  "tls-certificate-error",
+  "read-limit-exceeded",
 ]
 
 # zgrab2/module.go: ScanResponse
@@ -53,7 +65,33 @@ base_scan_response = SubRecord({
     "protocol": String(doc="The identifier of the protocol being scanned."),
     "timestamp": DateTime(doc="The time the scan was started."),
     "result": SubRecord({}, required=False),  # This is overridden by the protocols' implementations
-    "error": String(required=False, doc="If the status was not success, error may contain information about the failure.")
+    "error": String(required=False, doc="If the status was not success, error may contain information about the failure."),
+    "error_type": String(required=False, doc="The cause of the error, more precisely than the status (e.g. ECONNREFUSED, timeout, tls-alert-handshake-failure)."),
+    "service": SubRecord({
+        "product": String(doc="The name of the software."),
+        "version": String(doc="The version of the software."),
+        "vendor": String(doc="The CPE vendor name of the software."),
+        "cpe": String(doc="The CPE 2.3 formatted string naming the software."),
+        "confidence": Unsigned8BitInteger(doc="How certain the identification is, from 1 (a guess) to 10."),
+    }, required=False, doc="The identity of the service, for modules that report it."),
+    "source_ip": String(required=False, doc="The local address the target was scanned from, with --source-ip."),
+    "connection": SubRecord({
+        "local_address": String(required=False, doc="The local address of the first connection."),
+        "remote_address": String(required=False, doc="The remote address of the first connection."),
+        "resolved_ip": String(required=False, doc="The address of the target that was connected to."),
+        "port": Unsigned16BitInteger(required=False, doc="The port of the target."),
+        "connections": Unsigned32BitInteger(doc="The number of connections made."),
+        "dns": Double(required=False, doc="The time taken by the --resolve lookup, in seconds."),
+        "connect": Double(doc="The time taken to connect, in seconds, summed over the connections."),
+        "tls": Double(required=False, doc="The time taken by TLS handshakes, in seconds, summed over the connections."),
+        "first_byte": Double(required=False, doc="The time from connecting to reading the first byte, in seconds."),
+        "total": Double(doc="The time from the start of the first connection to the close of the last, in seconds."),
+        "bytes_read": Unsigned32BitInteger(doc="The number of bytes read, summed over the connections."),
+        "bytes_written": Unsigned32BitInteger(doc="The number of bytes written, summed over the connections."),
+        "truncated": Boolean(required=False, doc="Whether a read was cut short by the read limit."),
+    }, required=False, doc="The connections made by the last try of the scan, with --connection-info."),
+    "attempts": Unsigned32BitInteger(required=False, doc="The number of times the scan was tried, with --retries."),
+    "attempt_errors": ListOf(String(), required=False, doc="The errors of the tries before the last, in order."),
     # TODO: error_component? domain?
 })
 